@@ -13,7 +13,7 @@ import (
 var (
 	migrations = []darwin.Migration{
 		{
-			Version:     1,
+			Version:     "1",
 			Description: "Creating table posts",
 			Script: `CREATE TABLE posts (
 						id INTEGER PRIMARY KEY, 
@@ -21,7 +21,7 @@ var (
 					 );;`,
 		},
 		{
-			Version:     2,
+			Version:     "2",
 			Description: "Adding column body",
 			Script:      "ALTER TABLE posts ADD body TEXT AFTER title;",
 		},
@@ -47,7 +47,7 @@ func main() {
 	if info {
 		infos, _ := d.Info()
 		for _, info := range infos {
-			fmt.Printf("%.1f %s %s\n", info.Migration.Version, info.Status, info.Migration.Description)
+			fmt.Printf("%s %s %s\n", info.Migration.Version, info.Status, info.Migration.Description)
 		}
 	} else {
 		err = d.Migrate()
@@ -0,0 +1,54 @@
+package darwin
+
+import (
+	"context"
+	"fmt"
+)
+
+// BaselineError is used to report when Baseline is called on a database with migrations applied
+type BaselineError struct {
+	Version Version
+}
+
+func (b BaselineError) Error() string {
+	return fmt.Sprintf("Cannot baseline at version %s, the schema table is not empty", b.Version)
+}
+
+// Baseline marks an existing database as migrated up to version, so Migrate
+// only applies the newer migrations. It creates the schema table and inserts
+// the baseline entry, the schema table must be empty.
+// If the driver is a Locker, the lock is held during the whole process.
+func (d Darwin) Baseline(version Version, description string) error {
+	return d.BaselineContext(context.Background(), version, description)
+}
+
+// BaselineContext is like Baseline, but it stops when ctx is done
+func (d Darwin) BaselineContext(ctx context.Context, version Version, description string) error {
+	if !version.Valid() {
+		return IllegalMigrationVersionError{Version: version}
+	}
+
+	return d.locked(ctx, func(ctx context.Context) error {
+		err := createContext(ctx, d.driver)
+
+		if err != nil {
+			return err
+		}
+
+		applied, err := allContext(ctx, d.driver)
+
+		if err != nil {
+			return err
+		}
+
+		if len(applied) > 0 {
+			return BaselineError{Version: version}
+		}
+
+		record := d.newRecord(Migration{Version: version, Description: description})
+		record.Checksum = ""
+		record.Baseline = true
+
+		return insertContext(ctx, d.driver, record)
+	})
+}
@@ -0,0 +1,87 @@
+package darwin
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"hash/crc32"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ChecksumFunc calculates the checksum of a migration script, see Darwin.Checksum
+type ChecksumFunc func(script string) string
+
+// MD5Checksum returns the hexadecimal MD5 of the script, it is the default
+func MD5Checksum(script string) string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(script)))
+}
+
+// SHA256Checksum returns the hexadecimal SHA-256 of the script
+func SHA256Checksum(script string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(script)))
+}
+
+// CRC32Checksum returns the checksum calculated by Flyway: the CRC32 of the
+// lines of the script, without line endings nor byte order mark, as a signed
+// decimal number
+func CRC32Checksum(script string) string {
+	crc := crc32.NewIEEE()
+	scanner := bufio.NewScanner(strings.NewReader(strings.TrimPrefix(script, "\uFEFF")))
+	scanner.Buffer(nil, len(script)+1)
+	scanner.Split(scanLines)
+
+	for scanner.Scan() {
+		crc.Write(scanner.Bytes())
+	}
+
+	return strconv.FormatInt(int64(int32(crc.Sum32())), 10)
+}
+
+// scanLines is like bufio.ScanLines, but a single \r also ends a line
+func scanLines(data []byte, atEOF bool) (int, []byte, error) {
+	for i, c := range data {
+		switch c {
+		case '\n':
+			return i + 1, data[:i], nil
+		case '\r':
+			if i+1 < len(data) {
+				if data[i+1] == '\n' {
+					return i + 2, data[:i], nil
+				}
+
+				return i + 1, data[:i], nil
+			}
+
+			if atEOF {
+				return i + 1, data[:i], nil
+			}
+
+			// Wait for the next byte, it could be a \n
+			return 0, nil, nil
+		}
+	}
+
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+
+	return 0, nil, nil
+}
+
+var trailingSpaces = regexp.MustCompile(`[ \t]+\n`)
+
+// Normalized returns a ChecksumFunc calculating f of the normalized script,
+// so the checksum does not change when the line endings are converted or
+// trailing white space is added or removed
+func Normalized(f ChecksumFunc) ChecksumFunc {
+	return func(script string) string {
+		script = strings.Replace(script, "\r\n", "\n", -1)
+		script = strings.Replace(script, "\r", "\n", -1)
+		script = trailingSpaces.ReplaceAllString(script+"\n", "\n")
+
+		return f(strings.TrimRight(script, "\n"))
+	}
+}
@@ -0,0 +1,108 @@
+package darwin
+
+import (
+	"hash/crc32"
+	"strconv"
+	"testing"
+)
+
+func Test_MD5Checksum(t *testing.T) {
+	if checksum := MD5Checksum("does not matter!"); checksum != "3310d0ff858faac79e854454c9e403da" {
+		t.Errorf("MD5Checksum() = %s, wants 3310d0ff858faac79e854454c9e403da", checksum)
+	}
+}
+
+func Test_SHA256Checksum(t *testing.T) {
+	expected := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	if checksum := SHA256Checksum(""); checksum != expected {
+		t.Errorf("SHA256Checksum() = %s, wants %s", checksum, expected)
+	}
+}
+
+func Test_CRC32Checksum(t *testing.T) {
+	expected := strconv.FormatInt(int64(int32(crc32.ChecksumIEEE([]byte("SELECT 1;SELECT 2;")))), 10)
+	scripts := []string{
+		"SELECT 1;\nSELECT 2;",
+		"SELECT 1;\r\nSELECT 2;\r\n",
+		"SELECT 1;\rSELECT 2;\n",
+		"\uFEFFSELECT 1;\nSELECT 2;",
+	}
+
+	for _, script := range scripts {
+		if checksum := CRC32Checksum(script); checksum != expected {
+			t.Errorf("CRC32Checksum(%q) = %s, wants %s", script, checksum, expected)
+		}
+	}
+
+	if CRC32Checksum("SELECT 1;\nSELECT 3;") == expected {
+		t.Error("CRC32Checksum() must change with the script")
+	}
+}
+
+func Test_Normalized(t *testing.T) {
+	checksum := Normalized(MD5Checksum)
+	expected := MD5Checksum("SELECT 1;\nSELECT 2;")
+	scripts := []string{
+		"SELECT 1;\nSELECT 2;",
+		"SELECT 1;\r\nSELECT 2;\r\n",
+		"SELECT 1;  \nSELECT 2;\t\n\n",
+	}
+
+	for _, script := range scripts {
+		if actual := checksum(script); actual != expected {
+			t.Errorf("Normalized(MD5Checksum)(%q) = %s, wants %s", script, actual, expected)
+		}
+	}
+
+	if checksum("SELECT  1;\nSELECT 2;") == expected {
+		t.Error("Normalized() must keep the white space inside the lines")
+	}
+}
+
+func Test_Darwin_Checksum(t *testing.T) {
+	migrations := []Migration{
+		{
+			Version:     "1",
+			Description: "First Migration",
+			Script:      "does not matter!",
+		},
+		{
+			Version:     "2",
+			Description: "Second Migration",
+			Script:      "SELECT 2;",
+		},
+	}
+
+	driver := &dummyDriver{}
+	Migrate(driver, migrations, nil)
+
+	d := New(driver, migrations, nil)
+	d.Checksum = Normalized(SHA256Checksum)
+
+	if err := d.Validate(); err != nil {
+		t.Fatalf("The MD5 checksums must still be valid, got %s", err)
+	}
+
+	changes, err := d.Repair()
+
+	if err != nil || len(changes) != 2 {
+		t.Fatalf("Repair must replace the MD5 checksums, got %v %v", changes, err)
+	}
+
+	if driver.records[1].Checksum != SHA256Checksum("SELECT 2;") {
+		t.Errorf("Must store the normalized SHA-256, got %s", driver.records[1].Checksum)
+	}
+
+	migrations[1].Script = "SELECT 2;\r\n"
+
+	if err := d.Validate(); err != nil {
+		t.Fatalf("Changing the line endings must be valid, got %s", err)
+	}
+
+	migrations[1].Script = "SELECT 3;"
+
+	if _, ok := d.Validate().(InvalidChecksumError); !ok {
+		t.Error("Must detect changed scripts")
+	}
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/GuiaBolso/darwin"
+)
+
+// migrate applies the pending migrations, printing each one applied
+func (c *cli) migrate(ctx context.Context, args []string) int {
+	if len(args) > 0 {
+		return c.usageError("migrate takes no arguments")
+	}
+
+	infoChan := make(chan darwin.MigrationInfo)
+	done := make(chan []migrationOutput)
+
+	go func() {
+		applied := []migrationOutput{}
+
+		for info := range infoChan {
+			out := newMigrationOutput(info.Migration)
+			out.Status = info.Status.String()
+
+			if info.Error != nil {
+				out.Error = info.Error.Error()
+			}
+
+			if c.format == "table" {
+				fmt.Fprintf(c.stdout, "%s %s %s\n", out.Status, displayVersion(info.Migration), out.Description)
+			}
+
+			applied = append(applied, out)
+		}
+
+		done <- applied
+	}()
+
+	err := c.newDarwin(infoChan).MigrateContext(ctx)
+	close(infoChan)
+	applied := <-done
+
+	if c.format == "json" {
+		c.printJSON(applied)
+	} else if err == nil && len(applied) == 0 {
+		fmt.Fprintln(c.stdout, "Schema is up to date")
+	}
+
+	return c.exitCode(err)
+}
+
+// info prints the status of every migration and of the entries of the
+// schema table without migration file
+func (c *cli) info(ctx context.Context, args []string) int {
+	if len(args) > 0 {
+		return c.usageError("info takes no arguments")
+	}
+
+	infos, err := c.newDarwin(nil).InfoContext(ctx)
+
+	if err != nil {
+		return c.exitCode(err)
+	}
+
+	outputs := make([]migrationOutput, len(infos))
+
+	for i, info := range infos {
+		outputs[i] = newMigrationOutput(info.Migration)
+		outputs[i].Status = info.Status.String()
+
+		if info.Record != nil {
+			outputs[i].setRecord(*info.Record)
+		}
+	}
+
+	if c.format == "json" {
+		c.printJSON(outputs)
+		return exitOK
+	}
+
+	w := newTableWriter(c.stdout)
+	fmt.Fprintln(w, "VERSION\tDESCRIPTION\tTYPE\tSTATUS\tAPPLIED AT\tEXECUTION TIME\tINSTALLED BY")
+
+	for i, info := range infos {
+		appliedAt, executionTime := "", ""
+
+		if info.Record != nil {
+			appliedAt = info.Record.AppliedAt.Format(timeFormat)
+			executionTime = info.Record.ExecutionTime.String()
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", displayVersion(info.Migration), outputs[i].Description, outputs[i].Type, outputs[i].Status, appliedAt, executionTime, outputs[i].InstalledBy)
+	}
+
+	w.Flush()
+
+	return exitOK
+}
+
+// validate prints every validation problem, it fails if there is any
+func (c *cli) validate(ctx context.Context, args []string) int {
+	if len(args) > 0 {
+		return c.usageError("validate takes no arguments")
+	}
+
+	report, err := c.newDarwin(nil).ValidateAllContext(ctx)
+
+	if err != nil {
+		return c.exitCode(err)
+	}
+
+	problems := []string{}
+
+	for _, err := range report.Errors() {
+		problems = append(problems, err.Error())
+	}
+
+	if c.format == "json" {
+		c.printJSON(validationOutput{Valid: len(problems) == 0, Errors: problems})
+	} else if len(problems) == 0 {
+		fmt.Fprintln(c.stdout, "Migrations are valid")
+	} else {
+		for _, problem := range problems {
+			fmt.Fprintln(c.stdout, problem)
+		}
+	}
+
+	if len(problems) > 0 {
+		return exitInvalid
+	}
+
+	return exitOK
+}
+
+// plan prints the migrations that migrate would apply, as SQL with -format sql
+func (c *cli) plan(ctx context.Context, args []string) int {
+	if len(args) > 0 {
+		return c.usageError("plan takes no arguments")
+	}
+
+	p, err := c.newDarwin(nil).PlanContext(ctx)
+
+	if err != nil {
+		return c.exitCode(err)
+	}
+
+	switch c.format {
+	case "sql":
+		script, err := p.Script(c.dialect)
+
+		if err != nil {
+			return c.exitCode(err)
+		}
+
+		fmt.Fprint(c.stdout, script)
+
+		return exitOK
+	case "json":
+		out := planOutput{Migrations: []migrationOutput{}}
+
+		for _, migration := range p.Migrations {
+			out.Migrations = append(out.Migrations, newMigrationOutput(migration))
+		}
+
+		if p.ValidationError != nil {
+			out.ValidationError = p.ValidationError.Error()
+		}
+
+		c.printJSON(out)
+	default:
+		w := newTableWriter(c.stdout)
+		fmt.Fprintln(w, "VERSION\tDESCRIPTION\tTYPE")
+
+		for _, migration := range p.Migrations {
+			out := newMigrationOutput(migration)
+			fmt.Fprintf(w, "%s\t%s\t%s\n", displayVersion(migration), out.Description, out.Type)
+		}
+
+		w.Flush()
+	}
+
+	if p.ValidationError != nil {
+		return c.exitCode(p.ValidationError)
+	}
+
+	return exitOK
+}
+
+// repair prints every change made to the schema table
+func (c *cli) repair(ctx context.Context, args []string) int {
+	if len(args) > 0 {
+		return c.usageError("repair takes no arguments")
+	}
+
+	changes, err := c.newDarwin(nil).RepairContext(ctx)
+
+	if err != nil {
+		return c.exitCode(err)
+	}
+
+	if c.format == "json" {
+		outputs := make([]repairOutput, len(changes))
+
+		for i, change := range changes {
+			outputs[i] = repairOutput{
+				Action:      change.Action.String(),
+				Version:     string(change.Record.Version),
+				Description: change.Record.Description,
+				OldChecksum: change.Record.Checksum,
+				NewChecksum: change.Checksum,
+			}
+		}
+
+		c.printJSON(outputs)
+
+		return exitOK
+	}
+
+	if len(changes) == 0 {
+		fmt.Fprintln(c.stdout, "Nothing to repair")
+		return exitOK
+	}
+
+	w := newTableWriter(c.stdout)
+	fmt.Fprintln(w, "ACTION\tVERSION\tDESCRIPTION")
+
+	for _, change := range changes {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", change.Action, change.Record.Version, change.Record.Description)
+	}
+
+	w.Flush()
+
+	return exitOK
+}
+
+// baseline marks the database as migrated up to the version in args
+func (c *cli) baseline(ctx context.Context, args []string) int {
+	if len(args) < 1 || len(args) > 2 {
+		return c.usageError("baseline takes a version and an optional description")
+	}
+
+	version := darwin.Version(args[0])
+	description := "Baseline"
+
+	if len(args) == 2 {
+		description = args[1]
+	}
+
+	err := c.newDarwin(nil).BaselineContext(ctx, version, description)
+
+	if err != nil {
+		return c.exitCode(err)
+	}
+
+	if c.format == "json" {
+		c.printJSON(migrationOutput{
+			Version:     string(version),
+			Description: description,
+			Type:        "versioned",
+			Status:      darwin.Baseline.String(),
+		})
+	} else {
+		fmt.Fprintf(c.stdout, "Baselined at version %s\n", version)
+	}
+
+	return exitOK
+}
+
+// unlock removes the lock left in the lock table by a killed process
+func (c *cli) unlock(ctx context.Context, args []string) int {
+	if len(args) > 0 {
+		return c.usageError("unlock takes no arguments")
+	}
+
+	if err := c.driver.ForceUnlock(ctx); err != nil {
+		return c.exitCode(err)
+	}
+
+	fmt.Fprintln(c.stdout, "Lock released")
+
+	return exitOK
+}
+
+// usageError prints message and returns exitUsage
+func (c *cli) usageError(message string) int {
+	fmt.Fprintf(c.stderr, "darwin: %s\n", message)
+	return exitUsage
+}
+
+// exitCode prints err, if any, and returns the exit code for it
+func (c *cli) exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+
+	fmt.Fprintf(c.stderr, "darwin: %s\n", err)
+
+	if isValidationError(err) {
+		return exitInvalid
+	}
+
+	return exitError
+}
+
+// isValidationError reports whether err is a problem found by Validate or
+// a migration file that cannot be read as a migration
+func isValidationError(err error) bool {
+	var (
+		malformed    darwin.MalformedMigrationFileError
+		file         darwin.DuplicateMigrationFileError
+		validation   darwin.ValidationError
+		illegal      darwin.IllegalMigrationVersionError
+		duplicated   darwin.DuplicateMigrationVersionError
+		repeatable   darwin.DuplicateRepeatableMigrationError
+		funcChecksum darwin.MissingFuncChecksumError
+		failed       darwin.FailedMigrationError
+		removed      darwin.RemovedMigrationError
+		checksum     darwin.InvalidChecksumError
+		ignored      darwin.IgnoredMigrationError
+	)
+
+	return errors.As(err, &malformed) ||
+		errors.As(err, &file) ||
+		errors.As(err, &validation) ||
+		errors.As(err, &illegal) ||
+		errors.As(err, &duplicated) ||
+		errors.As(err, &repeatable) ||
+		errors.As(err, &funcChecksum) ||
+		errors.As(err, &failed) ||
+		errors.As(err, &removed) ||
+		errors.As(err, &checksum) ||
+		errors.As(err, &ignored)
+}
@@ -0,0 +1,288 @@
+// Command darwin applies the SQL migrations of a directory to a database,
+// so they can be run from a release pipeline without writing a program.
+//
+// Usage:
+//
+//	darwin [flags] <command> [arguments]
+//
+// The migrations are read from the .sql files of -dir, named like
+// V1__create_posts.sql or R__posts_view.sql, see darwin.FromFS. The -dsn and
+// -dialect flags default to the DARWIN_DSN and DARWIN_DIALECT environment
+// variables, so the password is not in the command line.
+//
+// The exit code is 0 on success, 1 when the database or a migration fails,
+// 2 on usage errors and 3 when the migrations are not valid.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/GuiaBolso/darwin"
+
+	_ "github.com/cznic/ql/driver"
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Exit codes
+const (
+	exitOK = iota
+	exitError
+	exitUsage
+	exitInvalid
+)
+
+const usage = `Usage: darwin [flags] <command> [arguments]
+
+Commands:
+  migrate                        apply the pending migrations
+  info                           show the status of every migration
+  validate                       check the applied migrations against the files
+  plan                           show the migrations that migrate would apply
+  repair                         remove failed entries and update the checksums
+  baseline <version> [description]
+                                 mark an existing database as migrated up to version
+  unlock                         release the lock left by a killed process, sqlite and ql only
+
+Flags:
+`
+
+// config holds the command line flags
+type config struct {
+	dialectName string
+	dsn         string
+	dir         string
+	table       string
+	schema      string
+	format      string
+	checksum    string
+	normalize   bool
+	target      string
+	outOfOrder  bool
+	strict      bool
+	lockTimeout time.Duration
+	installedBy string
+	appVersion  string
+}
+
+// cli is the state shared by the commands
+type cli struct {
+	config
+	stdout     io.Writer
+	stderr     io.Writer
+	dialect    darwin.Dialect
+	driver     *darwin.GenericDriver
+	migrations []darwin.Migration
+}
+
+// command runs a command with its arguments and returns the exit code
+type command func(c *cli, ctx context.Context, args []string) int
+
+var commands = map[string]command{
+	"migrate":  (*cli).migrate,
+	"info":     (*cli).info,
+	"validate": (*cli).validate,
+	"plan":     (*cli).plan,
+	"repair":   (*cli).repair,
+	"baseline": (*cli).baseline,
+	"unlock":   (*cli).unlock,
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the command line args and returns the exit code
+func run(args []string, stdout, stderr io.Writer) int {
+	c := &cli{stdout: stdout, stderr: stderr}
+	flags := newFlagSet(&c.config, stderr)
+
+	if err := flags.Parse(args); err != nil {
+		return parseErrorCode(err)
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	name := flags.Arg(0)
+	cmd, ok := commands[name]
+
+	if !ok {
+		fmt.Fprintf(stderr, "darwin: unknown command %q\n", name)
+		flags.Usage()
+		return exitUsage
+	}
+
+	// Flags are also accepted after the command, like darwin migrate -dir sql
+	if err := flags.Parse(flags.Args()[1:]); err != nil {
+		return parseErrorCode(err)
+	}
+
+	if err := c.check(name); err != nil {
+		fmt.Fprintf(stderr, "darwin: %s\n", err)
+		return exitUsage
+	}
+
+	driverName, dialect, err := newDialect(c.config)
+
+	if err != nil {
+		fmt.Fprintf(stderr, "darwin: %s\n", err)
+		return exitUsage
+	}
+
+	migrations, err := darwin.FromFS(os.DirFS(c.dir), ".")
+
+	if err != nil {
+		return c.exitCode(err)
+	}
+
+	db, err := sql.Open(driverName, c.dsn)
+
+	if err != nil {
+		fmt.Fprintf(stderr, "darwin: %s\n", err)
+		return exitError
+	}
+
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	c.dialect = dialect
+	c.driver = darwin.NewGenericDriver(db, dialect)
+	c.migrations = migrations
+
+	return cmd(c, ctx, flags.Args())
+}
+
+// newDarwin returns a darwin.Darwin configured by the flags
+func (c *cli) newDarwin(infoChan chan darwin.MigrationInfo) darwin.Darwin {
+	d := darwin.New(c.driver, c.migrations, infoChan)
+	d.Checksum, _ = checksumFunc(c.checksum, c.normalize)
+	d.LockTimeout = c.lockTimeout
+	d.OutOfOrder = c.outOfOrder
+	d.Strict = c.strict
+	d.Target = darwin.Version(c.target)
+	d.InstalledBy = c.installedBy
+	d.AppVersion = c.appVersion
+
+	return d
+}
+
+func newFlagSet(c *config, stderr io.Writer) *flag.FlagSet {
+	flags := flag.NewFlagSet("darwin", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+
+	flags.StringVar(&c.dialectName, "dialect", os.Getenv("DARWIN_DIALECT"), "database `dialect`: postgres, mysql, sqlite or ql (DARWIN_DIALECT)")
+	flags.StringVar(&c.dsn, "dsn", os.Getenv("DARWIN_DSN"), "data source name of the database (DARWIN_DSN)")
+	flags.StringVar(&c.dir, "dir", "migrations", "`directory` of the migration files")
+	flags.StringVar(&c.table, "table", "", "name of the schema table (default darwin_migrations)")
+	flags.StringVar(&c.schema, "schema", "", "schema of the schema table, not supported by ql")
+	flags.StringVar(&c.format, "format", "table", "output `format`: table or json, plan also accepts sql")
+	flags.StringVar(&c.checksum, "checksum", "md5", "checksum `algorithm`: md5, sha256 or crc32")
+	flags.BoolVar(&c.normalize, "normalize", false, "ignore line endings and trailing white space in the checksums")
+	flags.StringVar(&c.target, "target", "", "migrate up to this `version` only")
+	flags.BoolVar(&c.outOfOrder, "out-of-order", false, "apply migrations older than the last applied one")
+	flags.BoolVar(&c.strict, "strict", false, "fail when a migration would be ignored")
+	flags.DurationVar(&c.lockTimeout, "lock-timeout", 0, "how long to wait for other processes migrating, 0 waits forever")
+	flags.StringVar(&c.installedBy, "installed-by", "", "who applies the migrations, recorded in the schema table (default the database user)")
+	flags.StringVar(&c.appVersion, "app-version", "", "application `version` recorded in the schema table")
+
+	return flags
+}
+
+func parseErrorCode(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+
+	return exitUsage
+}
+
+// check validates the flags used by the command name
+func (c config) check(name string) error {
+	if c.dialectName == "" {
+		return errors.New("-dialect is required")
+	}
+
+	if c.dsn == "" {
+		return errors.New("-dsn is required")
+	}
+
+	switch {
+	case c.format == "sql" && name != "plan":
+		return fmt.Errorf("the sql format is only supported by plan")
+	case c.format != "table" && c.format != "json" && c.format != "sql":
+		return fmt.Errorf("unknown format %q", c.format)
+	}
+
+	if c.target != "" && !darwin.Version(c.target).Valid() {
+		return darwin.IllegalMigrationVersionError{Version: darwin.Version(c.target)}
+	}
+
+	_, err := checksumFunc(c.checksum, c.normalize)
+
+	return err
+}
+
+// newDialect returns the database/sql driver name and the dialect of c
+func newDialect(c config) (string, darwin.Dialect, error) {
+	switch c.dialectName {
+	case "postgres":
+		return "postgres", darwin.PostgresDialect{TableName: c.table, Schema: c.schema}, nil
+	case "mysql":
+		return "mysql", darwin.MySQLDialect{TableName: c.table, Schema: c.schema}, nil
+	case "sqlite":
+		return "sqlite3", darwin.SqliteDialect{TableName: c.table, Schema: c.schema}, nil
+	case "ql":
+		if c.schema != "" {
+			return "", nil, errors.New("ql does not support -schema")
+		}
+
+		return "ql", darwin.QLDialect{TableName: c.table}, nil
+	default:
+		return "", nil, fmt.Errorf("unknown dialect %q", c.dialectName)
+	}
+}
+
+// checksumFunc returns the darwin.ChecksumFunc named name, nil for the default
+func checksumFunc(name string, normalize bool) (darwin.ChecksumFunc, error) {
+	var f darwin.ChecksumFunc
+
+	switch name {
+	case "md5":
+		if !normalize {
+			return nil, nil
+		}
+
+		f = darwin.MD5Checksum
+	case "sha256":
+		f = darwin.SHA256Checksum
+	case "crc32":
+		f = darwin.CRC32Checksum
+	default:
+		return nil, fmt.Errorf("unknown checksum %q", name)
+	}
+
+	if normalize {
+		f = darwin.Normalized(f)
+	}
+
+	return f, nil
+}
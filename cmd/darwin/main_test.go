@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setup writes the migration files and returns the flags to use them with a
+// new ql database
+func setup(t *testing.T) (string, []string) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"V1__create_posts.sql": "CREATE TABLE posts (id int, title string);",
+		"V2__add_body.sql":     "ALTER TABLE posts ADD body string;",
+		"R__posts_count.sql":   "CREATE TABLE IF NOT EXISTS posts_count (n int);",
+	}
+
+	for name, script := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir, []string{"-dialect", "ql", "-dsn", filepath.Join(dir, "test.db"), "-dir", dir}
+}
+
+func runCommand(flags []string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+
+	code := run(append(append([]string{}, flags...), args...), &stdout, &stderr)
+
+	return code, stdout.String(), stderr.String()
+}
+
+func Test_run_usage(t *testing.T) {
+	_, flags := setup(t)
+
+	expectations := []struct {
+		args []string
+		code int
+	}{
+		{[]string{}, exitUsage},
+		{[]string{"-help"}, exitOK},
+		{[]string{"-unknown", "migrate"}, exitUsage},
+		{[]string{"rollback"}, exitUsage},
+		{append(append([]string{}, flags...), "info", "extra"), exitUsage},
+		{append(append([]string{}, flags...), "-format", "sql", "info"), exitUsage},
+		{append(append([]string{}, flags...), "-format", "xml", "info"), exitUsage},
+		{append(append([]string{}, flags...), "-checksum", "sha1", "info"), exitUsage},
+		{append(append([]string{}, flags...), "-target", "1.a", "migrate"), exitUsage},
+		{append(append([]string{}, flags...), "baseline"), exitUsage},
+		{[]string{"-dialect", "oracle", "-dsn", "x", "info"}, exitUsage},
+		{[]string{"-dialect", "ql", "info"}, exitUsage},
+	}
+
+	for _, expectation := range expectations {
+		if code, _, _ := runCommand(expectation.args); code != expectation.code {
+			t.Errorf("run(%q) = %d, wants %d", expectation.args, code, expectation.code)
+		}
+	}
+}
+
+func Test_run_migrate(t *testing.T) {
+	_, flags := setup(t)
+
+	code, stdout, stderr := runCommand(flags, "plan", "-format", "sql")
+
+	if code != exitOK || !strings.Contains(stdout, "ALTER TABLE posts ADD body string;") {
+		t.Fatalf("plan = %d %q %q", code, stdout, stderr)
+	}
+
+	code, stdout, stderr = runCommand(flags, "-installed-by", "deploy", "-app-version", "2.3.0", "migrate")
+
+	if code != exitOK {
+		t.Fatalf("migrate = %d, wants 0: %s", code, stderr)
+	}
+
+	expected := "APPLIED 1 create posts\nAPPLIED 2 add body\nAPPLIED R posts count\n"
+
+	if stdout != expected {
+		t.Errorf("migrate printed %q, wants %q", stdout, expected)
+	}
+
+	code, stdout, _ = runCommand(flags, "migrate")
+
+	if code != exitOK || stdout != "Schema is up to date\n" {
+		t.Errorf("migrate again = %d %q", code, stdout)
+	}
+
+	code, stdout, _ = runCommand(flags, "-format", "json", "info")
+
+	var infos []migrationOutput
+
+	if err := json.Unmarshal([]byte(stdout), &infos); err != nil || code != exitOK {
+		t.Fatalf("info = %d %q: %v", code, stdout, err)
+	}
+
+	if len(infos) != 3 {
+		t.Fatalf("info returned %d migrations, wants 3", len(infos))
+	}
+
+	repeatable := 0
+
+	for _, info := range infos {
+		if info.Status != "APPLIED" || info.AppliedAt == nil || info.Checksum == "" {
+			t.Errorf("Unexpected info %+v", info)
+		}
+
+		if info.InstalledBy != "deploy" || info.AppVersion != "2.3.0" || info.Rank == 0 {
+			t.Errorf("Unexpected installation details %+v", info)
+		}
+
+		if info.Type == "repeatable" {
+			repeatable++
+		}
+	}
+
+	if repeatable != 1 {
+		t.Errorf("info returned %d repeatable migrations, wants 1", repeatable)
+	}
+}
+
+func Test_run_plan_sql(t *testing.T) {
+	dir, flags := setup(t)
+
+	code, script, stderr := runCommand(flags, "-format", "sql", "plan")
+
+	if code != exitOK {
+		t.Fatalf("plan = %d: %s", code, stderr)
+	}
+
+	if err := execScript(filepath.Join(dir, "test.db"), script); err != nil {
+		t.Fatalf("Executing the plan failed: %s\n%s", err, script)
+	}
+
+	if code, stdout, _ := runCommand(flags, "migrate"); code != exitOK || stdout != "Schema is up to date\n" {
+		t.Errorf("migrate after the plan = %d %q", code, stdout)
+	}
+}
+
+// execScript executes the script in the ql database file in a transaction
+func execScript(file, script string) error {
+	db, err := sql.Open("ql", file)
+
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	tx, err := db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(script); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func Test_run_unlock(t *testing.T) {
+	dir, flags := setup(t)
+
+	// A process was killed holding the lock
+	err := execScript(filepath.Join(dir, "test.db"), "CREATE TABLE darwin_migrations_lock (id int); INSERT INTO darwin_migrations_lock VALUES (1);")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code, _, _ := runCommand(flags, "-lock-timeout", "10ms", "migrate"); code != exitError {
+		t.Errorf("migrate = %d, wants %d", code, exitError)
+	}
+
+	if code, stdout, _ := runCommand(flags, "unlock"); code != exitOK || stdout != "Lock released\n" {
+		t.Errorf("unlock = %d %q", code, stdout)
+	}
+
+	if code, _, stderr := runCommand(flags, "-lock-timeout", "10ms", "migrate"); code != exitOK {
+		t.Errorf("migrate after unlock = %d: %s", code, stderr)
+	}
+}
+
+func Test_run_validate(t *testing.T) {
+	dir, flags := setup(t)
+
+	// A new database has every migration pending
+	if code, _, stderr := runCommand(flags, "validate"); code != exitOK {
+		t.Errorf("validate on a new database = %d: %s", code, stderr)
+	}
+
+	if code, stdout, stderr := runCommand(flags, "info"); code != exitOK || strings.Count(stdout, "PENDING") != 3 {
+		t.Errorf("info on a new database = %d %q: %s", code, stdout, stderr)
+	}
+
+	if code, _, stderr := runCommand(flags, "migrate"); code != exitOK {
+		t.Fatalf("migrate = %d: %s", code, stderr)
+	}
+
+	if code, stdout, _ := runCommand(flags, "validate"); code != exitOK || stdout != "Migrations are valid\n" {
+		t.Errorf("validate = %d %q", code, stdout)
+	}
+
+	err := os.WriteFile(filepath.Join(dir, "V2__add_body.sql"), []byte("ALTER TABLE posts ADD body blob;"), 0644)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, stdout, _ := runCommand(flags, "-format", "json", "validate")
+
+	var report validationOutput
+
+	if err := json.Unmarshal([]byte(stdout), &report); err != nil || code != exitInvalid {
+		t.Fatalf("validate = %d %q: %v", code, stdout, err)
+	}
+
+	if report.Valid || len(report.Errors) != 1 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+
+	if code, _, _ := runCommand(flags, "migrate"); code != exitInvalid {
+		t.Errorf("migrate = %d, wants %d", code, exitInvalid)
+	}
+
+	if code, stdout, _ := runCommand(flags, "repair"); code != exitOK || !strings.Contains(stdout, "UPDATED CHECKSUM  2") {
+		t.Errorf("repair = %d %q", code, stdout)
+	}
+
+	if code, _, _ := runCommand(flags, "validate"); code != exitOK {
+		t.Errorf("validate after repair = %d, wants 0", code)
+	}
+}
+
+func Test_run_baseline(t *testing.T) {
+	dir, flags := setup(t)
+
+	if err := os.Remove(filepath.Join(dir, "V1__create_posts.sql")); err != nil {
+		t.Fatal(err)
+	}
+
+	if code, _, stderr := runCommand(flags, "baseline", "1", "Existing schema"); code != exitOK {
+		t.Fatalf("baseline = %d: %s", code, stderr)
+	}
+
+	// The baseline does not create the table, so migrating it must fail
+	code, stdout, _ := runCommand(flags, "migrate")
+
+	if code != exitError || stdout != "ERROR 2 add body\n" {
+		t.Errorf("migrate = %d %q, wants %d", code, stdout, exitError)
+	}
+
+	if code, _, _ := runCommand(flags, "baseline", "1"); code != exitError {
+		t.Errorf("baseline again = %d, wants %d", code, exitError)
+	}
+}
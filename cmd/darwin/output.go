@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/GuiaBolso/darwin"
+)
+
+// timeFormat is the format of the times in tables
+const timeFormat = "2006-01-02 15:04:05"
+
+// migrationOutput is a migration in the JSON output
+type migrationOutput struct {
+	Version       string     `json:"version"`
+	Description   string     `json:"description"`
+	Type          string     `json:"type"`
+	Status        string     `json:"status,omitempty"`
+	Checksum      string     `json:"checksum,omitempty"`
+	AppliedAt     *time.Time `json:"applied_at,omitempty"`
+	ExecutionTime string     `json:"execution_time,omitempty"`
+	Error         string     `json:"error,omitempty"`
+	InstalledBy   string     `json:"installed_by,omitempty"`
+	Hostname      string     `json:"hostname,omitempty"`
+	AppVersion    string     `json:"app_version,omitempty"`
+	Rank          int        `json:"rank,omitempty"`
+}
+
+// validationOutput is the JSON output of validate
+type validationOutput struct {
+	Valid  bool     `json:"valid"`
+	Errors []string `json:"errors"`
+}
+
+// planOutput is the JSON output of plan
+type planOutput struct {
+	Migrations      []migrationOutput `json:"migrations"`
+	ValidationError string            `json:"validation_error,omitempty"`
+}
+
+// repairOutput is a change in the JSON output of repair
+type repairOutput struct {
+	Action      string `json:"action"`
+	Version     string `json:"version"`
+	Description string `json:"description"`
+	OldChecksum string `json:"old_checksum"`
+	NewChecksum string `json:"new_checksum,omitempty"`
+}
+
+func newMigrationOutput(migration darwin.Migration) migrationOutput {
+	out := migrationOutput{
+		Version:     string(migration.Version),
+		Description: migration.Description,
+		Type:        "versioned",
+	}
+
+	if migration.Repeatable {
+		out.Type = "repeatable"
+	}
+
+	return out
+}
+
+// setRecord adds the details of the entry in the schema table
+func (m *migrationOutput) setRecord(record darwin.MigrationRecord) {
+	appliedAt := record.AppliedAt
+
+	m.Checksum = record.Checksum
+	m.AppliedAt = &appliedAt
+	m.ExecutionTime = record.ExecutionTime.String()
+	m.Error = record.ErrorMessage
+	m.InstalledBy = record.InstalledBy
+	m.Hostname = record.Hostname
+	m.AppVersion = record.AppVersion
+	m.Rank = record.Rank
+}
+
+// displayVersion returns the version shown in tables, R for repeatable migrations
+func displayVersion(migration darwin.Migration) string {
+	if migration.Repeatable {
+		return "R"
+	}
+
+	return string(migration.Version)
+}
+
+func newTableWriter(w io.Writer) *tabwriter.Writer {
+	return tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+}
+
+// printJSON prints v as indented JSON
+func (c *cli) printJSON(v interface{}) {
+	b, err := json.MarshalIndent(v, "", "  ")
+
+	if err != nil {
+		fmt.Fprintf(c.stderr, "darwin: %s\n", err)
+		return
+	}
+
+	fmt.Fprintln(c.stdout, string(b))
+}
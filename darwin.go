@@ -1,8 +1,11 @@
 package darwin
 
 import (
-	"crypto/md5"
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"os"
 	"sort"
 	"sync"
 	"time"
@@ -20,6 +23,16 @@ const (
 	Pending
 	// Error means that the migration could not be applied to the database
 	Error
+	// Baseline means that the migration was already in the database when it was baselined
+	Baseline
+	// AboveTarget means that the migration is pending but newer than the Target
+	AboveTarget
+	// Outdated means that the repeatable migration was changed since it was
+	// applied, it is applied again by Migrate
+	Outdated
+	// Missing means that the migration was applied but it is not in the
+	// migration list anymore
+	Missing
 )
 
 func (s Status) String() string {
@@ -32,6 +45,14 @@ func (s Status) String() string {
 		return "PENDING"
 	case Error:
 		return "ERROR"
+	case Baseline:
+		return "BASELINE"
+	case AboveTarget:
+		return "ABOVE TARGET"
+	case Outdated:
+		return "OUTDATED"
+	case Missing:
+		return "MISSING"
 	default:
 		return "INVALID"
 	}
@@ -40,16 +61,58 @@ func (s Status) String() string {
 // A global mutex
 var mutex = &sync.Mutex{}
 
+// ErrFuncNotSupported is returned by Migrate when a migration has a Func and
+// the driver is not a FuncDriver, before applying any migration
+var ErrFuncNotSupported = errors.New("darwin: the driver does not support Go migrations")
+
+// ErrNoTxNotSupported is returned by Migrate when a migration has NoTransaction
+// and the driver is not a NoTxDriver, before applying any migration
+var ErrNoTxNotSupported = errors.New("darwin: the driver does not support migrations without transaction")
+
+// MigrationFunc is a migration written in Go, it runs in the transaction tx
+type MigrationFunc func(ctx context.Context, tx *sql.Tx) error
+
 // Migration represents a database migrations.
 type Migration struct {
-	Version     float64
+	Version     Version
 	Description string
 	Script      string
+
+	// Func is used instead of Script when it is not nil
+	Func MigrationFunc
+
+	// FuncChecksum is the checksum of Func, it is required with Func. Change
+	// it when Func is changed, so Validate detects it.
+	FuncChecksum string
+
+	// UndoScript reverts the changes made by Script, it is optional and
+	// only used by Undo
+	UndoScript string
+
+	// Repeatable migrations have no Version, they are identified by the
+	// Description. Migrate applies them after the versioned migrations,
+	// every time their checksum changes, like views and stored procedures.
+	Repeatable bool
+
+	// NoTransaction runs the Script outside a transaction, for statements
+	// like CREATE INDEX CONCURRENTLY. The changes made before a failure are
+	// not rolled back. Go migrations always run in a transaction.
+	NoTransaction bool
 }
 
-// Checksum calculate the Script md5
+// Checksum calculate the Script md5, or returns the FuncChecksum of a Go
+// migration
 func (m Migration) Checksum() string {
-	return fmt.Sprintf("%x", md5.Sum([]byte(m.Script)))
+	if m.Func != nil {
+		return m.FuncChecksum
+	}
+
+	return MD5Checksum(m.Script)
+}
+
+// noRollback reports whether the migration runs outside a transaction
+func (m Migration) noRollback() bool {
+	return m.NoTransaction && m.Func == nil
 }
 
 // MigrationInfo is a struct used in the infoChan to inform clients about
@@ -58,6 +121,14 @@ type MigrationInfo struct {
 	Status    Status
 	Error     error
 	Migration Migration
+
+	// NoRollback is true when a failure of the migration is not rolled
+	// back, because it runs outside a transaction
+	NoRollback bool
+
+	// Record is the entry of the migration in the schema table, the last
+	// one of repeatable migrations. It is nil when it was not applied yet.
+	Record *MigrationRecord
 }
 
 // Darwin is a helper struct to access the Validate and migration functions
@@ -65,21 +136,406 @@ type Darwin struct {
 	driver     Driver
 	migrations []Migration
 	infoChan   chan MigrationInfo
+
+	// LockTimeout is how long Migrate waits for the lock held by other
+	// processes when the driver is a Locker. Zero means wait forever.
+	LockTimeout time.Duration
+
+	// OutOfOrder makes Migrate apply the migrations older than the last
+	// applied one, instead of ignoring them.
+	OutOfOrder bool
+
+	// Strict makes Validate fail with an IgnoredMigrationError when some
+	// migration would be ignored. It has no effect with OutOfOrder.
+	Strict bool
+
+	// Target makes Migrate stop at this version, the newer migrations are
+	// not applied. Empty means the latest version.
+	Target Version
+
+	// Checksum calculates the checksum of the scripts, MD5Checksum if nil.
+	// The MD5 checksums stored before changing it are still valid, Repair
+	// replaces them.
+	Checksum ChecksumFunc
+
+	// InstalledBy is recorded in the schema table as who applied the
+	// migrations, like the user running a deploy. The database user is
+	// recorded when empty, if the database has users.
+	InstalledBy string
+
+	// AppVersion is recorded in the schema table as the version of the
+	// application that applied the migrations
+	AppVersion string
 }
 
-// Validate if the database migrations are applied and consistent
+// Validate if the database migrations are applied and consistent. When there
+// are many problems, the error is a ValidationError with all of them, use
+// errors.As to look for a specific one. See ValidateAll.
 func (d Darwin) Validate() error {
-	return Validate(d.driver, d.migrations)
+	return d.ValidateContext(context.Background())
+}
+
+// ValidateContext is like Validate, but it stops when ctx is done
+func (d Darwin) ValidateContext(ctx context.Context) error {
+	report, err := d.ValidateAllContext(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	return report.Err()
 }
 
-// Migrate executes the missing migrations in database
+// Migrate executes the missing migrations in database.
+// If the driver is a Locker, the lock is held during the whole process.
 func (d Darwin) Migrate() error {
-	return Migrate(d.driver, d.migrations, d.infoChan)
+	return d.MigrateContext(context.Background())
+}
+
+// MigrateContext is like Migrate, but it stops when ctx is done.
+// Migrations already applied are kept.
+func (d Darwin) MigrateContext(ctx context.Context) error {
+	return d.locked(ctx, func(ctx context.Context) error {
+		err := createContext(ctx, d.driver)
+
+		if err != nil {
+			return err
+		}
+
+		err = d.ValidateContext(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		planned, err := planMigration(ctx, d.driver, d.migrations, d.OutOfOrder, d.validChecksum)
+
+		if err != nil {
+			return err
+		}
+
+		planned = upToTarget(planned, d.Target)
+
+		if err := d.supported(planned); err != nil {
+			return err
+		}
+
+		for _, migration := range planned {
+			err = d.apply(ctx, migration)
+
+			// A failed repeatable migration keeps the previous checksum,
+			// so it is applied again by the next run
+			if err != nil && !migration.Repeatable {
+				d.recordFailure(ctx, migration, err)
+			}
+
+			notify(err, migration, d.infoChan)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// MigrateTo is like Migrate, but it stops at the target version, see Target
+func (d Darwin) MigrateTo(target Version) error {
+	return d.MigrateToContext(context.Background(), target)
+}
+
+// MigrateToContext is like MigrateTo, but it stops when ctx is done
+func (d Darwin) MigrateToContext(ctx context.Context, target Version) error {
+	if !target.Valid() {
+		return IllegalMigrationVersionError{Version: target}
+	}
+
+	d.Target = target
+
+	return d.MigrateContext(ctx)
+}
+
+// locked calls f holding the global mutex and, if the driver is a Locker,
+// the database lock. The context passed to f tells the driver the lock is
+// held by the caller, see lockHeld.
+func (d Darwin) locked(ctx context.Context, f func(ctx context.Context) error) (err error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if locker, ok := d.driver.(Locker); ok {
+		err = locker.Lock(ctx, d.LockTimeout)
+
+		if err != nil {
+			return err
+		}
+
+		defer func() {
+			if uerr := locker.Unlock(); err == nil {
+				err = uerr
+			}
+		}()
+
+		ctx = context.WithValue(ctx, lockHeldKey{}, true)
+	}
+
+	return f(ctx)
+}
+
+// lockHeldKey is the context key set while the work runs holding the lock
+type lockHeldKey struct{}
+
+// lockHeld reports whether ctx is of the work done holding the lock of the
+// driver, other goroutines using the same driver do not hold it
+func lockHeld(ctx context.Context) bool {
+	held, _ := ctx.Value(lockHeldKey{}).(bool)
+	return held
+}
+
+// supported returns ErrFuncNotSupported or ErrNoTxNotSupported when the driver
+// cannot apply one of the migrations, so none of them is applied or recorded
+func (d Darwin) supported(migrations []Migration) error {
+	_, funcDriver := d.driver.(FuncDriver)
+	noTxDriver := supportsNoTx(d.driver)
+
+	for _, migration := range migrations {
+		if migration.Func != nil && !funcDriver {
+			return ErrFuncNotSupported
+		}
+
+		if migration.Func == nil && migration.NoTransaction && !noTxDriver {
+			return ErrNoTxNotSupported
+		}
+	}
+
+	return nil
 }
 
-// Info returns the status of all migrations
+// supportsNoTx reports whether the driver is a NoTxDriver able to run
+// scripts outside a transaction with its database
+func supportsNoTx(driver Driver) bool {
+	if _, ok := driver.(NoTxDriver); !ok {
+		return false
+	}
+
+	checker, ok := driver.(noTxChecker)
+
+	return !ok || checker.supportsNoTx()
+}
+
+// apply executes the migration and records it, both in the same transaction
+// when the driver is a TxDriver. Go migrations require a FuncDriver and the
+// ones with NoTransaction a NoTxDriver.
+func (d Darwin) apply(ctx context.Context, migration Migration) error {
+	record := d.newRecord(migration)
+
+	if migration.Func != nil {
+		funcDriver, ok := d.driver.(FuncDriver)
+
+		if !ok {
+			return ErrFuncNotSupported
+		}
+
+		return funcDriver.ExecFuncInsert(ctx, migration.Func, record)
+	}
+
+	if migration.NoTransaction {
+		noTxDriver, ok := d.driver.(NoTxDriver)
+
+		if !ok {
+			return ErrNoTxNotSupported
+		}
+
+		dur, err := noTxDriver.ExecNoTx(ctx, migration.Script)
+
+		if err != nil {
+			return NoRollbackError{Version: migration.Version, Err: err}
+		}
+
+		record.ExecutionTime = dur
+
+		return insertContext(ctx, d.driver, record)
+	}
+
+	if txDriver, ok := d.driver.(TxDriver); ok {
+		return txDriver.ExecInsert(ctx, migration.Script, record)
+	}
+
+	dur, err := execContext(ctx, d.driver, migration.Script)
+
+	if err != nil {
+		return err
+	}
+
+	record.ExecutionTime = dur
+
+	return insertContext(ctx, d.driver, record)
+}
+
+// recordFailure inserts a failed entry for the migration, so the next runs
+// refuse to proceed until it is repaired. It is the only trace left when the
+// database does not support transactional DDL. The insert error is ignored,
+// the migration error is more relevant.
+func (d Darwin) recordFailure(ctx context.Context, migration Migration, err error) {
+	record := d.newRecord(migration)
+	record.Failed = true
+	record.ErrorMessage = err.Error()
+
+	insertContext(ctx, d.driver, record)
+}
+
+// checksum returns the checksum of the migration script calculated by
+// Checksum, or the FuncChecksum of a Go migration
+func (d Darwin) checksum(migration Migration) string {
+	if migration.Func != nil || d.Checksum == nil {
+		return migration.Checksum()
+	}
+
+	return d.Checksum(migration.Script)
+}
+
+// validChecksum reports whether checksum, stored in the schema table, is the
+// checksum of the migration. The MD5 checksums of the scripts are valid too,
+// they were stored before the Checksum was changed.
+func (d Darwin) validChecksum(migration Migration, checksum string) bool {
+	return checksum == d.checksum(migration) || checksum == migration.Checksum()
+}
+
+// newRecord returns the entry recorded in the schema table for the migration,
+// the ExecutionTime is not known yet and the Rank is set by the database
+func (d Darwin) newRecord(migration Migration) MigrationRecord {
+	return MigrationRecord{
+		Version:     migration.Version,
+		Description: migration.Description,
+		Checksum:    d.checksum(migration),
+		AppliedAt:   appliedAt(time.Now()),
+		InstalledBy: d.InstalledBy,
+		Hostname:    hostname(),
+		AppVersion:  d.AppVersion,
+	}
+}
+
+// hostname returns the name of the host recorded in the schema table, empty
+// if it is unknown
+func hostname() string {
+	name, _ := os.Hostname()
+	return name
+}
+
+// Info returns the status of all migrations. Like Plan, it does not change
+// the database: they are all pending when the schema table does not exist.
 func (d Darwin) Info() ([]MigrationInfo, error) {
-	return Info(d.driver, d.migrations)
+	return d.InfoContext(context.Background())
+}
+
+// InfoContext is like Info, but it stops when ctx is done
+func (d Darwin) InfoContext(ctx context.Context) ([]MigrationInfo, error) {
+	info := []MigrationInfo{}
+	records, err := d.appliedRecords(ctx)
+
+	if err != nil {
+		return info, err
+	}
+
+	checksums := repeatableChecksums(records)
+
+	// The last record of each migration, the ones left at the end have no
+	// migration
+	left := map[string]MigrationRecord{}
+
+	for _, record := range records {
+		left[recordKey(record.Version, record.Description)] = record
+	}
+
+	sort.Stable(sort.Reverse(byMigrationRecordVersion(records)))
+
+	for _, migration := range d.migrations {
+		record := takeRecord(left, migration)
+
+		if migration.Repeatable {
+			info = append(info, MigrationInfo{
+				Status:     getRepeatableStatus(checksums, migration, d.validChecksum),
+				Migration:  migration,
+				NoRollback: migration.noRollback(),
+				Record:     record,
+			})
+			continue
+		}
+
+		status, err := getStatus(records, migration)
+
+		// Ignored migrations are applied when running out of order
+		if status == Ignored && d.OutOfOrder {
+			status = Pending
+		}
+
+		if status == Pending && d.Target != "" && migration.Version.Compare(d.Target) > 0 {
+			status = AboveTarget
+		}
+
+		info = append(info, MigrationInfo{
+			Status:     status,
+			Error:      err,
+			Migration:  migration,
+			NoRollback: migration.noRollback(),
+			Record:     record,
+		})
+	}
+
+	sort.Stable(byMigrationRecordVersion(records))
+
+	for _, record := range records {
+		migration := Migration{
+			Version:     record.Version,
+			Description: record.Description,
+			Repeatable:  record.Version == "",
+		}
+
+		record := takeRecord(left, migration)
+
+		if record == nil {
+			continue
+		}
+
+		status := Missing
+
+		if record.Baseline {
+			status = Baseline
+		}
+
+		info = append(info, MigrationInfo{
+			Status:    status,
+			Migration: migration,
+			Record:    record,
+		})
+	}
+
+	return info, nil
+}
+
+// recordKey identifies the records of a migration, repeatable migrations
+// have no version
+func recordKey(version Version, description string) string {
+	if version == "" {
+		return "R" + description
+	}
+
+	return "V" + string(version.canonical())
+}
+
+// takeRecord removes the record of the migration from records and returns
+// it, nil if there is none
+func takeRecord(records map[string]MigrationRecord, migration Migration) *MigrationRecord {
+	key := recordKey(migration.Version, migration.Description)
+	record, ok := records[key]
+
+	if !ok {
+		return nil
+	}
+
+	delete(records, key)
+
+	return &record
 }
 
 // New returns a new Darwin struct
@@ -93,163 +549,188 @@ func New(driver Driver, migrations []Migration, infoChan chan MigrationInfo) Dar
 
 // DuplicateMigrationVersionError is used to report when the migration list has duplicated entries
 type DuplicateMigrationVersionError struct {
-	Version float64
+	Version Version
 }
 
 func (d DuplicateMigrationVersionError) Error() string {
-	return fmt.Sprintf("Multiple migrations have the version number %f.", d.Version)
+	return fmt.Sprintf("Multiple migrations have the version number %s.", d.Version)
 }
 
 // IllegalMigrationVersionError is used to report when the migration has an illegal Version number
 type IllegalMigrationVersionError struct {
-	Version float64
+	Version Version
 }
 
 func (i IllegalMigrationVersionError) Error() string {
-	return fmt.Sprintf("Illegal migration version number %f.", i.Version)
+	return fmt.Sprintf("Illegal migration version number %q.", i.Version)
 }
 
 // RemovedMigrationError is used to report when a migration is removed from the list
 type RemovedMigrationError struct {
-	Version float64
+	Version Version
 }
 
 func (r RemovedMigrationError) Error() string {
-	return fmt.Sprintf("Migration %f was removed", r.Version)
+	return fmt.Sprintf("Migration %s was removed", r.Version)
 }
 
 // InvalidChecksumError is used to report when a migration was modified
 type InvalidChecksumError struct {
-	Version float64
+	Version Version
+
+	// Stored is the checksum in the schema table and Computed the checksum
+	// of the migration
+	Stored   string
+	Computed string
 }
 
 func (i InvalidChecksumError) Error() string {
-	return fmt.Sprintf("Invalid cheksum for migration %f", i.Version)
+	return fmt.Sprintf("Invalid cheksum for migration %s", i.Version)
 }
 
-// Validate if the database migrations are applied and consistent
-func Validate(d Driver, migrations []Migration) error {
-	sort.Sort(byMigrationVersion(migrations))
+// LockTimeoutError is used to report when the migration lock could not be acquired in time
+type LockTimeoutError struct {
+	Timeout time.Duration
+}
 
-	if version, invalid := isInvalidVersion(migrations); invalid {
-		return IllegalMigrationVersionError{Version: version}
-	}
+func (l LockTimeoutError) Error() string {
+	return fmt.Sprintf("Could not acquire the migration lock in %s", l.Timeout)
+}
 
-	if version, dup := isDuplicated(migrations); dup {
-		return DuplicateMigrationVersionError{Version: version}
-	}
+// FailedMigrationError is used to report when the schema table has a failed migration
+type FailedMigrationError struct {
+	Version Version
+	Message string
+}
 
-	applied, err := d.All()
+func (f FailedMigrationError) Error() string {
+	return fmt.Sprintf("Migration %s failed: %s. Repair it before migrating", f.Version, f.Message)
+}
 
-	if err != nil {
-		return err
-	}
+// IgnoredMigrationError is used to report when a migration older than the last applied one was not applied
+type IgnoredMigrationError struct {
+	Version Version
+}
 
-	if version, removed := wasRemovedMigration(applied, migrations); removed {
-		return RemovedMigrationError{Version: version}
-	}
+func (i IgnoredMigrationError) Error() string {
+	return fmt.Sprintf("Migration %s is older than the last applied migration and was ignored", i.Version)
+}
 
-	if version, invalid := isInvalidChecksumMigration(applied, migrations); invalid {
-		return InvalidChecksumError{Version: version}
-	}
+// MissingFuncChecksumError is used to report a Go migration without FuncChecksum
+type MissingFuncChecksumError struct {
+	Version Version
+}
 
-	return nil
+func (m MissingFuncChecksumError) Error() string {
+	return fmt.Sprintf("Missing checksum for the Go migration %s", m.Version)
 }
 
-// Info returns the status of all migrations
-func Info(d Driver, migrations []Migration) ([]MigrationInfo, error) {
-	info := []MigrationInfo{}
-	records, err := d.All()
+// NoRollbackError is used to report a failed migration with NoTransaction,
+// the changes made before the failure were not rolled back
+type NoRollbackError struct {
+	Version Version
+	Err     error
+}
 
-	if err != nil {
-		return info, err
-	}
+func (n NoRollbackError) Error() string {
+	return fmt.Sprintf("Migration %s failed outside a transaction and was not rolled back: %s", n.Version, n.Err)
+}
 
-	sort.Sort(sort.Reverse(byMigrationRecordVersion(records)))
+// Unwrap returns the error of the migration
+func (n NoRollbackError) Unwrap() error {
+	return n.Err
+}
 
-	for _, migration := range migrations {
-		info = append(info, MigrationInfo{
-			Status:    getStatus(records, migration),
-			Error:     nil,
-			Migration: migration,
-		})
-	}
+// DuplicateRepeatableMigrationError is used to report when the migration list has repeatable migrations with the same description
+type DuplicateRepeatableMigrationError struct {
+	Description string
+}
 
-	return info, nil
+func (d DuplicateRepeatableMigrationError) Error() string {
+	return fmt.Sprintf("Multiple repeatable migrations have the description %q.", d.Description)
+}
+
+// Validate if the database migrations are applied and consistent
+func Validate(d Driver, migrations []Migration) error {
+	return ValidateContext(context.Background(), d, migrations)
+}
+
+// ValidateContext is like Validate, but it stops when ctx is done
+func ValidateContext(ctx context.Context, d Driver, migrations []Migration) error {
+	return New(d, migrations, nil).ValidateContext(ctx)
+}
+
+// Info returns the status of all migrations. Like Plan, it does not change
+// the database: they are all pending when the schema table does not exist.
+func Info(d Driver, migrations []Migration) ([]MigrationInfo, error) {
+	return InfoContext(context.Background(), d, migrations)
+}
+
+// InfoContext is like Info, but it stops when ctx is done
+func InfoContext(ctx context.Context, d Driver, migrations []Migration) ([]MigrationInfo, error) {
+	return New(d, migrations, nil).InfoContext(ctx)
 }
 
-func getStatus(inDatabase []MigrationRecord, migration Migration) Status {
+func getStatus(inDatabase []MigrationRecord, migration Migration) (Status, error) {
+	// Nothing was applied yet
+	if len(inDatabase) == 0 {
+		return Pending, nil
+	}
+
 	last := inDatabase[0]
 
+	// Check Baseline
+	if version, ok := baselineVersion(inDatabase); ok && migration.Version.Compare(version) <= 0 {
+		return Baseline, nil
+	}
+
 	// Check Pending
-	if migration.Version > last.Version {
-		return Pending
+	if migration.Version.Compare(last.Version) > 0 {
+		return Pending, nil
 	}
 
 	// Check Ignored
 	found := false
 
 	for _, record := range inDatabase {
-		if record.Version == migration.Version {
+		if record.Version.Equal(migration.Version) {
 			found = true
+
+			if record.Failed {
+				return Error, errors.New(record.ErrorMessage)
+			}
 		}
 	}
 
 	if !found {
-		return Ignored
+		return Ignored, nil
 	}
 
-	return Applied
+	return Applied, nil
 }
 
-// Migrate executes the missing migrations in database.
-func Migrate(d Driver, migrations []Migration, infoChan chan MigrationInfo) error {
-	mutex.Lock()
-	defer mutex.Unlock()
-
-	err := d.Create()
-
-	if err != nil {
-		return err
-	}
-
-	err = Validate(d, migrations)
+func getRepeatableStatus(checksums map[string]string, migration Migration, validChecksum func(Migration, string) bool) Status {
+	checksum, ok := checksums[migration.Description]
 
-	if err != nil {
-		return err
+	if !ok {
+		return Pending
 	}
 
-	planned, err := planMigration(d, migrations)
-
-	if err != nil {
-		return err
+	if !validChecksum(migration, checksum) {
+		return Outdated
 	}
 
-	for _, migration := range planned {
-		dur, err := d.Exec(migration.Script)
-
-		if err != nil {
-			notify(err, migration, infoChan)
-			return err
-		}
-
-		err = d.Insert(MigrationRecord{
-			Version:       migration.Version,
-			Description:   migration.Description,
-			Checksum:      migration.Checksum(),
-			AppliedAt:     time.Now(),
-			ExecutionTime: dur,
-		})
-
-		notify(err, migration, infoChan)
-
-		if err != nil {
-			return err
-		}
+	return Applied
+}
 
-	}
+// Migrate executes the missing migrations in database.
+func Migrate(d Driver, migrations []Migration, infoChan chan MigrationInfo) error {
+	return MigrateContext(context.Background(), d, migrations, infoChan)
+}
 
-	return nil
+// MigrateContext is like Migrate, but it stops when ctx is done
+func MigrateContext(ctx context.Context, d Driver, migrations []Migration, infoChan chan MigrationInfo) error {
+	return New(d, migrations, infoChan).MigrateContext(ctx)
 }
 
 func notify(err error, migration Migration, infoChan chan MigrationInfo) {
@@ -265,111 +746,316 @@ func notify(err error, migration Migration, infoChan chan MigrationInfo) {
 	// The listener could print in the Stdout a message about the applied migration
 	if infoChan != nil {
 		infoChan <- MigrationInfo{
-			Status:    status,
-			Error:     err,
-			Migration: migration,
+			Status:     status,
+			Error:      err,
+			Migration:  migration,
+			NoRollback: migration.noRollback(),
 		}
 	}
 
 }
 
-func wasRemovedMigration(applied []MigrationRecord, migrations []Migration) (float64, bool) {
-	versionMap := map[float64]Migration{}
+func failedMigrations(applied []MigrationRecord) []MigrationRecord {
+	failed := []MigrationRecord{}
 
-	for _, migration := range migrations {
-		versionMap[migration.Version] = migration
+	for _, migration := range applied {
+		if migration.Failed {
+			failed = append(failed, migration)
+		}
 	}
 
+	return failed
+}
+
+func baselineVersion(applied []MigrationRecord) (Version, bool) {
 	for _, migration := range applied {
-		if _, ok := versionMap[migration.Version]; !ok {
+		if migration.Baseline {
 			return migration.Version, true
 		}
 	}
 
-	return 0, false
+	return "", false
 }
 
-func isInvalidChecksumMigration(applied []MigrationRecord, migrations []Migration) (float64, bool) {
-	versionMap := map[float64]MigrationRecord{}
+func removedMigrations(applied []MigrationRecord, migrations []Migration) []Version {
+	removed := []Version{}
+	versionMap := map[Version]Migration{}
+
+	for _, migration := range migrations {
+		versionMap[migration.Version.canonical()] = migration
+	}
 
 	for _, migration := range applied {
-		versionMap[migration.Version] = migration
+		if _, ok := versionMap[migration.Version.canonical()]; !ok && !migration.Baseline {
+			removed = append(removed, migration.Version)
+		}
+	}
+
+	return removed
+}
+
+// invalidChecksumMigrations returns the migrations whose checksum is not the
+// stored one, with both checksums
+func (d Darwin) invalidChecksumMigrations(applied []MigrationRecord, migrations []Migration) []InvalidChecksumError {
+	invalid := []InvalidChecksumError{}
+	versionMap := map[Version]MigrationRecord{}
+
+	for _, migration := range applied {
+		versionMap[migration.Version.canonical()] = migration
 	}
 
 	for _, migration := range migrations {
-		if m, ok := versionMap[migration.Version]; ok {
-			if m.Checksum != migration.Checksum() {
-				return migration.Version, true
+		if m, ok := versionMap[migration.Version.canonical()]; ok && !m.Baseline {
+			if !d.validChecksum(migration, m.Checksum) {
+				invalid = append(invalid, InvalidChecksumError{
+					Version:  migration.Version,
+					Stored:   m.Checksum,
+					Computed: d.checksum(migration),
+				})
 			}
 		}
 	}
 
-	return 0, false
+	return invalid
+}
+
+func ignoredMigrations(applied []MigrationRecord, migrations []Migration) []Version {
+	ignored := []Version{}
+
+	if len(applied) == 0 {
+		return ignored
+	}
+
+	versionMap := map[Version]MigrationRecord{}
+	last := applied[0].Version
+
+	for _, migration := range applied {
+		versionMap[migration.Version.canonical()] = migration
+
+		if migration.Version.Compare(last) > 0 {
+			last = migration.Version
+		}
+	}
+
+	baseline, baselined := baselineVersion(applied)
+
+	for _, migration := range migrations {
+		if baselined && migration.Version.Compare(baseline) <= 0 {
+			continue
+		}
+
+		if _, ok := versionMap[migration.Version.canonical()]; !ok && migration.Version.Valid() && migration.Version.Compare(last) < 0 {
+			ignored = append(ignored, migration.Version)
+		}
+	}
+
+	return ignored
 }
 
-func isInvalidVersion(migrations []Migration) (float64, bool) {
+func invalidVersions(migrations []Migration) []Version {
+	invalid := []Version{}
+
 	for _, migration := range migrations {
 		version := migration.Version
 
-		if version < 0 {
-			return version, true
+		if migration.Repeatable {
+			if version != "" {
+				invalid = append(invalid, version)
+			}
+
+			continue
+		}
+
+		if !version.Valid() {
+			invalid = append(invalid, version)
+		}
+	}
+
+	return invalid
+}
+
+func missingFuncChecksums(migrations []Migration) []Version {
+	missing := []Version{}
+
+	for _, migration := range migrations {
+		if migration.Func != nil && migration.FuncChecksum == "" {
+			missing = append(missing, migration.Version)
 		}
 	}
 
-	return 0, false
+	return missing
 }
 
-func isDuplicated(migrations []Migration) (float64, bool) {
-	unique := map[float64]Migration{}
+// duplicatedVersions returns each duplicated version once
+func duplicatedVersions(migrations []Migration) []Version {
+	duplicated := []Version{}
+	count := map[Version]int{}
+	migrations, _ = splitRepeatable(migrations)
 
 	for _, migration := range migrations {
-		_, exists := unique[migration.Version]
+		count[migration.Version.canonical()]++
 
-		if exists {
-			return migration.Version, true
+		if count[migration.Version.canonical()] == 2 {
+			duplicated = append(duplicated, migration.Version)
 		}
+	}
+
+	return duplicated
+}
 
-		unique[migration.Version] = migration
+// duplicatedRepeatables returns each duplicated description once
+func duplicatedRepeatables(migrations []Migration) []string {
+	duplicated := []string{}
+	count := map[string]int{}
+	_, repeatable := splitRepeatable(migrations)
+
+	for _, migration := range repeatable {
+		count[migration.Description]++
+
+		if count[migration.Description] == 2 {
+			duplicated = append(duplicated, migration.Description)
+		}
 	}
 
-	return 0, false
+	return duplicated
 }
 
-func planMigration(d Driver, migrations []Migration) ([]Migration, error) {
-	records, err := d.All()
+// splitRepeatable returns the versioned and the repeatable migrations
+func splitRepeatable(migrations []Migration) ([]Migration, []Migration) {
+	versioned := []Migration{}
+	repeatable := []Migration{}
+
+	for _, migration := range migrations {
+		if migration.Repeatable {
+			repeatable = append(repeatable, migration)
+		} else {
+			versioned = append(versioned, migration)
+		}
+	}
+
+	return versioned, repeatable
+}
+
+// versionedRecords returns the entries of the versioned migrations, the
+// entries of repeatable migrations have no version
+func versionedRecords(records []MigrationRecord) []MigrationRecord {
+	versioned := []MigrationRecord{}
+
+	for _, record := range records {
+		if record.Version != "" {
+			versioned = append(versioned, record)
+		}
+	}
+
+	return versioned
+}
+
+// repeatableChecksums returns the last checksum applied of each repeatable
+// migration by description, records must be in the order they were inserted
+func repeatableChecksums(records []MigrationRecord) map[string]string {
+	checksums := map[string]string{}
+
+	for _, record := range records {
+		if record.Version == "" && !record.Failed {
+			checksums[record.Description] = record.Checksum
+		}
+	}
+
+	return checksums
+}
+
+func planMigration(ctx context.Context, d Driver, migrations []Migration, outOfOrder bool, validChecksum func(Migration, string) bool) ([]Migration, error) {
+	records, err := allContext(ctx, d)
 
 	if err != nil {
 		return []Migration{}, err
 	}
 
-	// Apply all migrations
-	if len(records) == 0 {
-		return migrations, nil
-	}
+	return plannedMigrations(records, migrations, outOfOrder, validChecksum), nil
+}
+
+// plannedMigrations returns the migrations to be applied after the records
+func plannedMigrations(records []MigrationRecord, migrations []Migration, outOfOrder bool, validChecksum func(Migration, string) bool) []Migration {
+	migrations, repeatable := splitRepeatable(migrations)
+	checksums := repeatableChecksums(records)
+	records = versionedRecords(records)
 
 	// Which migrations needs to be applied
 	planned := []Migration{}
 
-	// Make sure the order is correct
-	// Do not trust the driver.
-	sort.Sort(sort.Reverse(byMigrationRecordVersion(records)))
-	last := records[0]
+	// Apply all migrations
+	if len(records) == 0 {
+		planned = append(planned, migrations...)
+	} else {
+		// Make sure the order is correct
+		// Do not trust the driver.
+		sort.Sort(sort.Reverse(byMigrationRecordVersion(records)))
+		last := records[0]
 
-	// Apply all migrations that are greater than the last migration
-	for _, migration := range migrations {
-		if migration.Version > last.Version {
-			planned = append(planned, migration)
+		applied := map[Version]bool{}
+
+		for _, record := range records {
+			applied[record.Version.canonical()] = true
+		}
+
+		// Migrations up to the baseline are already in the database
+		baseline, baselined := baselineVersion(records)
+
+		// Apply all migrations that are greater than the last migration,
+		// and the older ones not applied yet when running out of order
+		for _, migration := range migrations {
+			if baselined && migration.Version.Compare(baseline) <= 0 {
+				continue
+			}
+
+			if migration.Version.Compare(last.Version) > 0 || (outOfOrder && !applied[migration.Version.canonical()]) {
+				planned = append(planned, migration)
+			}
 		}
 	}
 
 	// Make sure the order is correct
 	sort.Sort(byMigrationVersion(planned))
 
-	return planned, nil
+	// Repeatable migrations are applied after the versioned ones, when
+	// they are new or changed
+	sort.Sort(byMigrationDescription(repeatable))
+
+	for _, migration := range repeatable {
+		if checksum, ok := checksums[migration.Description]; !ok || !validChecksum(migration, checksum) {
+			planned = append(planned, migration)
+		}
+	}
+
+	return planned
+}
+
+// upToTarget returns the migrations not newer than target, all of them when
+// target is empty. Repeatable migrations are always returned.
+func upToTarget(migrations []Migration, target Version) []Migration {
+	if target == "" {
+		return migrations
+	}
+
+	result := []Migration{}
+
+	for _, migration := range migrations {
+		if migration.Repeatable || migration.Version.Compare(target) <= 0 {
+			result = append(result, migration)
+		}
+	}
+
+	return result
 }
 
 type byMigrationVersion []Migration
 
 func (b byMigrationVersion) Len() int           { return len(b) }
 func (b byMigrationVersion) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
-func (b byMigrationVersion) Less(i, j int) bool { return b[i].Version < b[j].Version }
+func (b byMigrationVersion) Less(i, j int) bool { return b[i].Version.Compare(b[j].Version) < 0 }
+
+type byMigrationDescription []Migration
+
+func (b byMigrationDescription) Len() int           { return len(b) }
+func (b byMigrationDescription) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byMigrationDescription) Less(i, j int) bool { return b[i].Description < b[j].Description }
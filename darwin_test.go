@@ -1,8 +1,9 @@
 package darwin
 
 import (
+	"context"
+	"database/sql"
 	"errors"
-	"fmt"
 	"sort"
 	"testing"
 	"time"
@@ -40,6 +41,29 @@ func (d *dummyDriver) All() ([]MigrationRecord, error) {
 	return d.records, nil
 }
 
+func (d *dummyDriver) Delete(ctx context.Context, version Version) error {
+	records := []MigrationRecord{}
+
+	for _, record := range d.records {
+		if record.Version != version {
+			records = append(records, record)
+		}
+	}
+
+	d.records = records
+	return nil
+}
+
+func (d *dummyDriver) UpdateChecksum(ctx context.Context, version Version, checksum string) error {
+	for i := range d.records {
+		if d.records[i].Version == version {
+			d.records[i].Checksum = checksum
+		}
+	}
+
+	return nil
+}
+
 func (d *dummyDriver) Exec(string) (time.Duration, error) {
 	if d.ExecError {
 		return time.Millisecond * 1, errors.New("Error")
@@ -48,6 +72,92 @@ func (d *dummyDriver) Exec(string) (time.Duration, error) {
 	return time.Millisecond * 1, nil
 }
 
+type lockingDriver struct {
+	dummyDriver
+	LockError bool
+	locked    bool
+	unlocked  bool
+}
+
+func (d *lockingDriver) Lock(ctx context.Context, timeout time.Duration) error {
+	if d.LockError {
+		return LockTimeoutError{Timeout: timeout}
+	}
+
+	d.locked = true
+	return nil
+}
+
+func (d *lockingDriver) Unlock() error {
+	d.unlocked = true
+	return nil
+}
+
+func (d *lockingDriver) Exec(s string) (time.Duration, error) {
+	if !d.locked || d.unlocked {
+		return 0, errors.New("Exec called without the lock")
+	}
+
+	return d.dummyDriver.Exec(s)
+}
+
+// insertTxDummyDriver implements only ExecInsert of the optional interfaces
+type insertTxDummyDriver struct {
+	dummyDriver
+	execInserted int
+}
+
+func (d *insertTxDummyDriver) ExecInsert(ctx context.Context, script string, m MigrationRecord) error {
+	if _, err := d.Exec(script); err != nil {
+		return err
+	}
+
+	d.execInserted++
+
+	return d.Insert(m)
+}
+
+type txDummyDriver struct {
+	dummyDriver
+	execInserted int
+	execDeleted  int
+	execNoTx     int
+}
+
+func (d *txDummyDriver) ExecInsert(ctx context.Context, script string, m MigrationRecord) error {
+	if _, err := d.Exec(script); err != nil {
+		return err
+	}
+
+	d.execInserted++
+
+	return d.Insert(m)
+}
+
+func (d *txDummyDriver) ExecFuncInsert(ctx context.Context, f MigrationFunc, m MigrationRecord) error {
+	if err := f(ctx, nil); err != nil {
+		return err
+	}
+
+	return d.Insert(m)
+}
+
+func (d *txDummyDriver) ExecNoTx(ctx context.Context, script string) (time.Duration, error) {
+	d.execNoTx++
+
+	return d.Exec(script)
+}
+
+func (d *txDummyDriver) ExecDelete(ctx context.Context, script string, version Version) error {
+	if _, err := d.Exec(script); err != nil {
+		return err
+	}
+
+	d.execDeleted++
+
+	return d.Delete(ctx, version)
+}
+
 func Test_Status_String(t *testing.T) {
 	expectations := []struct {
 		status   Status
@@ -65,6 +175,18 @@ func Test_Status_String(t *testing.T) {
 		{
 			Error, "ERROR",
 		},
+		{
+			Baseline, "BASELINE",
+		},
+		{
+			AboveTarget, "ABOVE TARGET",
+		},
+		{
+			Outdated, "OUTDATED",
+		},
+		{
+			Missing, "MISSING",
+		},
 		{
 			Status(-1), "INVALID",
 		},
@@ -83,12 +205,12 @@ func Test_Info(t *testing.T) {
 
 	records := []MigrationRecord{
 		{
-			Version:     1.0,
+			Version:     "1.0",
 			Description: "1.0",
 			AppliedAt:   baseTime,
 		},
 		{
-			Version:     2.0,
+			Version:     "2.0",
 			Description: "2.0",
 			AppliedAt:   baseTime.Add(2 * time.Second),
 		},
@@ -96,22 +218,22 @@ func Test_Info(t *testing.T) {
 
 	migrations := []Migration{
 		{
-			Version:     1.0,
+			Version:     "1.0",
 			Description: "Must Be APPLIED",
 			Script:      "does not matter!",
 		},
 		{
-			Version:     1.1,
+			Version:     "1.1",
 			Description: "Must Be IGNORED",
 			Script:      "does not matter!",
 		},
 		{
-			Version:     2.0,
+			Version:     "2.0",
 			Description: "Must Be APPLIED",
 			Script:      "does not matter!",
 		},
 		{
-			Version:     3.0,
+			Version:     "3.0",
 			Description: "Must Be PENDING",
 			Script:      "does not matter!",
 		},
@@ -136,6 +258,205 @@ func Test_Info(t *testing.T) {
 	}
 }
 
+func Test_Info_empty_database(t *testing.T) {
+	migrations := []Migration{
+		{
+			Version:     "1",
+			Description: "First Migration",
+			Script:      "does not matter!",
+		},
+		{
+			Description: "Posts view",
+			Script:      "does not matter!",
+			Repeatable:  true,
+		},
+	}
+
+	infos, err := Info(&dummyDriver{}, migrations)
+
+	if err != nil {
+		t.Fatalf("Info() error = %s, wants nil", err)
+	}
+
+	if len(infos) != 2 {
+		t.Fatalf("len(Info()) = %d, wants 2", len(infos))
+	}
+
+	for _, info := range infos {
+		if info.Status != Pending || info.Record != nil {
+			t.Errorf("%s must be PENDING without record, got %s", info.Migration.Description, info.Status)
+		}
+	}
+}
+
+func Test_Info_records(t *testing.T) {
+	baseTime, _ := time.Parse(time.RFC3339, "2002-10-02T15:00:00Z")
+
+	records := []MigrationRecord{
+		{
+			Version:     "1",
+			Description: "Existing schema",
+			AppliedAt:   baseTime,
+			Baseline:    true,
+		},
+		{
+			Version:       "2",
+			Description:   "Second Migration",
+			Checksum:      "3310d0ff858faac79e854454c9e403da",
+			AppliedAt:     baseTime.Add(time.Second),
+			ExecutionTime: time.Millisecond,
+		},
+		{
+			Version:     "3",
+			Description: "Removed Migration",
+			Checksum:    "3310d0ff858faac79e854454c9e403da",
+			AppliedAt:   baseTime.Add(2 * time.Second),
+		},
+		{
+			Description: "Posts view",
+			Checksum:    "old",
+			AppliedAt:   baseTime.Add(3 * time.Second),
+		},
+		{
+			Description: "Posts view",
+			Checksum:    "3310d0ff858faac79e854454c9e403da",
+			AppliedAt:   baseTime.Add(4 * time.Second),
+		},
+		{
+			Description: "Removed view",
+			Checksum:    "3310d0ff858faac79e854454c9e403da",
+			AppliedAt:   baseTime.Add(5 * time.Second),
+		},
+	}
+
+	migrations := []Migration{
+		{
+			Version:     "2",
+			Description: "Second Migration",
+			Script:      "does not matter!",
+		},
+		{
+			Version:     "4",
+			Description: "Fourth Migration",
+			Script:      "does not matter!",
+		},
+		{
+			Description: "Posts view",
+			Script:      "does not matter!",
+			Repeatable:  true,
+		},
+	}
+
+	// Info sorts the records of the driver, so the expected ones are copied first
+	record := func(i int) *MigrationRecord {
+		r := records[i]
+		return &r
+	}
+
+	expectations := []struct {
+		status      Status
+		description string
+		record      *MigrationRecord
+	}{
+		{Applied, "Second Migration", record(1)},
+		{Pending, "Fourth Migration", nil},
+		{Applied, "Posts view", record(4)},
+		{Missing, "Removed view", record(5)},
+		{Baseline, "Existing schema", record(0)},
+		{Missing, "Removed Migration", record(2)},
+	}
+
+	infos, err := Info(&dummyDriver{records: records}, migrations)
+
+	if err != nil {
+		t.Fatalf("Info() error = %s, wants nil", err)
+	}
+
+	if len(infos) != len(expectations) {
+		t.Fatalf("len(Info()) = %d, wants %d", len(infos), len(expectations))
+	}
+
+	for i, expected := range expectations {
+		info := infos[i]
+
+		if info.Status != expected.status || info.Migration.Description != expected.description {
+			t.Errorf("infos[%d] = %s %s, wants %s %s", i, info.Status, info.Migration.Description, expected.status, expected.description)
+		}
+
+		if (info.Record == nil) != (expected.record == nil) || (info.Record != nil && *info.Record != *expected.record) {
+			t.Errorf("infos[%d].Record = %v, wants %v", i, info.Record, expected.record)
+		}
+	}
+}
+
+func Test_Baseline(t *testing.T) {
+	migrations := []Migration{
+		{Version: "1", Description: "Already in the database", Script: "does not matter!"},
+		{Version: "2", Description: "Already in the database", Script: "does not matter!"},
+		{Version: "3", Description: "Must Be PENDING", Script: "does not matter!"},
+	}
+
+	driver := &dummyDriver{}
+	d := New(driver, migrations, nil)
+	d.OutOfOrder = true
+
+	if err := d.Baseline("2", "Existing schema"); err != nil {
+		t.Fatalf("Baseline() error = %s, wants nil", err)
+	}
+
+	if err := d.Baseline("2", "Existing schema"); err != (BaselineError{Version: "2"}) {
+		t.Errorf("Must not baseline twice, got %v", err)
+	}
+
+	infos, err := d.Info()
+
+	if err != nil {
+		t.Fatal("Must not return error")
+	}
+
+	expectations := []Status{Baseline, Baseline, Pending}
+
+	for i, info := range infos {
+		if expectations[i] != info.Status {
+			t.Errorf("Expected %s, got %s", expectations[i], info.Status)
+		}
+	}
+
+	if err := d.Migrate(); err != nil {
+		t.Fatalf("Migrate() error = %s, wants nil", err)
+	}
+
+	if len(driver.records) != 2 || driver.records[1].Version != "3" {
+		t.Errorf("Must only apply the migrations after the baseline, got %v", driver.records)
+	}
+}
+
+func Test_Baseline_without_migration(t *testing.T) {
+	migrations := []Migration{
+		{Version: "3", Description: "Must Be APPLIED", Script: "does not matter!"},
+	}
+
+	driver := &dummyDriver{}
+	d := New(driver, migrations, nil)
+	d.Strict = true
+
+	if err := d.Baseline("2", "Existing schema"); err != nil {
+		t.Fatalf("Baseline() error = %s, wants nil", err)
+	}
+
+	if err := d.Migrate(); err != nil {
+		t.Errorf("Must not consider the baseline removed, got %s", err)
+	}
+}
+
+func Test_BaselineError_Error(t *testing.T) {
+	err := BaselineError{Version: "1"}
+
+	if err.Error() != "Cannot baseline at version 1, the schema table is not empty" {
+		t.Error("Must inform the baseline version")
+	}
+}
+
 func Test_Info_with_error(t *testing.T) {
 	driver := &dummyDriver{AllError: true}
 	migrations := []Migration{}
@@ -148,41 +469,65 @@ func Test_Info_with_error(t *testing.T) {
 }
 
 func Test_DuplicateMigrationVersionError_Error(t *testing.T) {
-	err := DuplicateMigrationVersionError{Version: 1}
+	err := DuplicateMigrationVersionError{Version: "1"}
 
-	if err.Error() != fmt.Sprintf("Multiple migrations have the version number %f.", 1.0) {
+	if err.Error() != "Multiple migrations have the version number 1." {
 		t.Error("Must inform the version of the duplicated migration")
 	}
 }
 
 func Test_IllegalMigrationVersionError_Error(t *testing.T) {
-	err := IllegalMigrationVersionError{Version: 1}
+	err := IllegalMigrationVersionError{Version: "1"}
 
-	if err.Error() != fmt.Sprintf("Illegal migration version number %f.", 1.0) {
+	if err.Error() != "Illegal migration version number \"1\"." {
 		t.Error("Must inform the version of the invalid migration")
 	}
 }
 
 func Test_RemovedMigrationError_Error(t *testing.T) {
-	err := RemovedMigrationError{Version: 1}
+	err := RemovedMigrationError{Version: "1"}
 
-	if err.Error() != fmt.Sprintf("Migration %f was removed", 1.0) {
+	if err.Error() != "Migration 1 was removed" {
 		t.Error("Must inform when a migration is removed from the list")
 	}
 }
 
 func Test_InvalidChecksumError_Error(t *testing.T) {
-	err := InvalidChecksumError{Version: 1}
+	err := InvalidChecksumError{Version: "1"}
 
-	if err.Error() != fmt.Sprintf("Invalid cheksum for migration %f", 1.0) {
+	if err.Error() != "Invalid cheksum for migration 1" {
 		t.Error("Must inform when a migration have an invalid checksum")
 	}
 }
 
+func Test_LockTimeoutError_Error(t *testing.T) {
+	err := LockTimeoutError{Timeout: time.Second}
+
+	if err.Error() != "Could not acquire the migration lock in 1s" {
+		t.Error("Must inform the lock timeout")
+	}
+}
+
+func Test_FailedMigrationError_Error(t *testing.T) {
+	err := FailedMigrationError{Version: "1", Message: "syntax error"}
+
+	if err.Error() != "Migration 1 failed: syntax error. Repair it before migrating" {
+		t.Error("Must inform the version and the error of the failed migration")
+	}
+}
+
+func Test_IgnoredMigrationError_Error(t *testing.T) {
+	err := IgnoredMigrationError{Version: "1"}
+
+	if err.Error() != "Migration 1 is older than the last applied migration and was ignored" {
+		t.Error("Must inform the version of the ignored migration")
+	}
+}
+
 func Test_Validate_invalid_version(t *testing.T) {
 	migrations := []Migration{
 		{
-			Version:     -1,
+			Version:     "-1",
 			Description: "Hello World",
 			Script:      "does not matter!",
 		},
@@ -190,7 +535,7 @@ func Test_Validate_invalid_version(t *testing.T) {
 
 	err := Validate(&dummyDriver{}, migrations)
 
-	if err.(IllegalMigrationVersionError).Version != -1 {
+	if err.(IllegalMigrationVersionError).Version != "-1" {
 		t.Errorf("Must not accept migrations with invalid version numbers")
 	}
 }
@@ -198,12 +543,12 @@ func Test_Validate_invalid_version(t *testing.T) {
 func Test_Validate_duplicated_version(t *testing.T) {
 	migrations := []Migration{
 		{
-			Version:     1,
+			Version:     "1",
 			Description: "Hello World",
 			Script:      "does not matter!",
 		},
 		{
-			Version:     1,
+			Version:     "1",
 			Description: "Hello World",
 			Script:      "does not matter!",
 		},
@@ -211,7 +556,7 @@ func Test_Validate_duplicated_version(t *testing.T) {
 
 	err := Validate(&dummyDriver{}, migrations)
 
-	if err.(DuplicateMigrationVersionError).Version != 1 {
+	if err.(DuplicateMigrationVersionError).Version != "1" {
 		t.Errorf("Must not accept migrations with duplicated version numbers")
 	}
 }
@@ -220,16 +565,16 @@ func Test_Validate_removed_migration(t *testing.T) {
 	// Other fields are not necessary for testing...
 	records := []MigrationRecord{
 		{
-			Version: 1.0,
+			Version: "1.0",
 		},
 		{
-			Version: 1.1,
+			Version: "1.1",
 		},
 	}
 
 	migrations := []Migration{
 		{
-			Version:     1.1,
+			Version:     "1.1",
 			Description: "Hello World",
 			Script:      "does not matter!",
 		},
@@ -239,7 +584,9 @@ func Test_Validate_removed_migration(t *testing.T) {
 	d := New(&dummyDriver{records: records}, migrations, nil)
 	err := d.Validate()
 
-	if err.(RemovedMigrationError).Version != 1 {
+	var removed RemovedMigrationError
+
+	if !errors.As(err, &removed) || !removed.Version.Equal("1") {
 		t.Errorf("Must not validate when some migration was removed from the migration list")
 	}
 }
@@ -248,14 +595,14 @@ func Test_Validate_invalid_checksum(t *testing.T) {
 	// Other fields are not necessary for testing...
 	records := []MigrationRecord{
 		{
-			Version:  1.0,
+			Version:  "1.0",
 			Checksum: "3310d0ff858faac79e854454c9e403db",
 		},
 	}
 
 	migrations := []Migration{
 		{
-			Version:     1.0,
+			Version:     "1.0",
 			Description: "Hello World",
 			Script:      "does not matter!",
 		},
@@ -263,20 +610,104 @@ func Test_Validate_invalid_checksum(t *testing.T) {
 
 	err := Validate(&dummyDriver{records: records}, migrations)
 
-	if err.(InvalidChecksumError).Version != 1 {
+	if !err.(InvalidChecksumError).Version.Equal("1") {
 		t.Errorf("Must not validate when some migration differ from the migration applied in the database")
 	}
 }
 
+func Test_Validate_strict_ignored_migration(t *testing.T) {
+	records := []MigrationRecord{
+		{
+			Version:  "1.0",
+			Checksum: "3310d0ff858faac79e854454c9e403da",
+		},
+		{
+			Version:  "2.0",
+			Checksum: "3310d0ff858faac79e854454c9e403da",
+		},
+	}
+
+	migrations := []Migration{
+		{Version: "1.0", Description: "First", Script: "does not matter!"},
+		{Version: "1.1", Description: "Ignored", Script: "does not matter!"},
+		{Version: "2.0", Description: "Second", Script: "does not matter!"},
+	}
+
+	d := New(&dummyDriver{records: records}, migrations, nil)
+
+	if err := d.Validate(); err != nil {
+		t.Errorf("Must ignore older migrations by default, got %s", err)
+	}
+
+	d.Strict = true
+
+	if err := d.Validate(); err != (IgnoredMigrationError{Version: "1.1"}) {
+		t.Errorf("Must not validate ignored migrations in strict mode, got %v", err)
+	}
+
+	d.OutOfOrder = true
+
+	if err := d.Validate(); err != nil {
+		t.Errorf("Must validate ignored migrations running out of order, got %s", err)
+	}
+}
+
+func Test_Migrate_out_of_order(t *testing.T) {
+	records := []MigrationRecord{
+		{
+			Version:  "1.0",
+			Checksum: "3310d0ff858faac79e854454c9e403da",
+		},
+		{
+			Version:  "2.0",
+			Checksum: "3310d0ff858faac79e854454c9e403da",
+		},
+	}
+
+	migrations := []Migration{
+		{Version: "1.0", Description: "First", Script: "does not matter!"},
+		{Version: "1.2", Description: "Out of order", Script: "does not matter!"},
+		{Version: "1.1", Description: "Out of order", Script: "does not matter!"},
+		{Version: "2.0", Description: "Second", Script: "does not matter!"},
+		{Version: "3.0", Description: "Third", Script: "does not matter!"},
+	}
+
+	driver := &dummyDriver{records: records}
+	infoChan := make(chan MigrationInfo, 3)
+
+	d := New(driver, migrations, infoChan)
+	d.OutOfOrder = true
+
+	infos, _ := d.Info()
+
+	for _, info := range infos {
+		if info.Migration.Version == "1.1" && info.Status != Pending {
+			t.Errorf("Expected %s, got %s", Pending, info.Status)
+		}
+	}
+
+	if err := d.Migrate(); err != nil {
+		t.Errorf("Must apply out of order migrations, got %s", err)
+	}
+
+	for _, expected := range []Version{"1.1", "1.2", "3.0"} {
+		info := <-infoChan
+
+		if info.Migration.Version != expected {
+			t.Errorf("Expected migration %s, got %s", expected, info.Migration.Version)
+		}
+	}
+}
+
 func Test_Migrate_migrate_all(t *testing.T) {
 	migrations := []Migration{
 		{
-			Version:     1,
+			Version:     "1",
 			Description: "First Migration",
 			Script:      "does not matter!",
 		},
 		{
-			Version:     2,
+			Version:     "2",
 			Description: "Second Migration",
 			Script:      "does not matter!",
 		},
@@ -296,13 +727,13 @@ func Test_Migrate_migrate_all(t *testing.T) {
 
 	info := <-infoChan
 
-	if info.Migration.Version != 1 {
+	if info.Migration.Version != "1" {
 		t.Errorf("Must send a message for each migration applied")
 	}
 
 	info = <-infoChan
 
-	if info.Migration.Version != 2 {
+	if info.Migration.Version != "2" {
 		t.Errorf("Must send a message for each migration applied")
 	}
 }
@@ -310,24 +741,24 @@ func Test_Migrate_migrate_all(t *testing.T) {
 func Test_Migrate_migrate_partial(t *testing.T) {
 	applied := []MigrationRecord{
 		{
-			Version:  1,
+			Version:  "1",
 			Checksum: "3310d0ff858faac79e854454c9e403da",
 		},
 	}
 
 	migrations := []Migration{
 		{
-			Version:     1,
+			Version:     "1",
 			Description: "First Migration",
 			Script:      "does not matter!",
 		},
 		{
-			Version:     2,
+			Version:     "2",
 			Description: "Second Migration",
 			Script:      "does not matter!",
 		},
 		{
-			Version:     3,
+			Version:     "3",
 			Description: "Third Migration",
 			Script:      "does not matter!",
 		},
@@ -352,18 +783,105 @@ func Test_Migrate_migrate_partial(t *testing.T) {
 	}
 }
 
-func Test_Migrate_migrate_error(t *testing.T) {
-	driver := &dummyDriver{CreateError: true}
-	migrations := []Migration{}
+func Test_MigrateTo(t *testing.T) {
+	migrations := []Migration{
+		{
+			Version:     "1",
+			Description: "First Migration",
+			Script:      "does not matter!",
+		},
+		{
+			Version:     "1.1",
+			Description: "Second Migration",
+			Script:      "does not matter!",
+		},
+		{
+			Version:     "2",
+			Description: "Third Migration",
+			Script:      "does not matter!",
+		},
+	}
 
-	err := Migrate(driver, migrations, nil)
+	driver := &dummyDriver{}
+	d := New(driver, migrations, nil)
 
-	if err == nil {
-		t.Error("Must emit error")
+	if err := d.MigrateTo("1.1"); err != nil {
+		t.Fatalf("MigrateTo() error = %s, wants nil", err)
 	}
-}
 
-func Test_Migrate_with_error_in_Validate(t *testing.T) {
+	if len(driver.records) != 2 || driver.records[1].Version != "1.1" {
+		t.Errorf("Must apply the migrations up to the target, got %v", driver.records)
+	}
+
+	if err := d.Migrate(); err != nil {
+		t.Fatalf("Migrate() error = %s, wants nil", err)
+	}
+
+	if len(driver.records) != 3 {
+		t.Errorf("Must apply the remaining migrations, got %v", driver.records)
+	}
+}
+
+func Test_MigrateTo_invalid_version(t *testing.T) {
+	err := New(&dummyDriver{}, []Migration{}, nil).MigrateTo("1.a")
+
+	if _, ok := err.(IllegalMigrationVersionError); !ok {
+		t.Errorf("MigrateTo() error = %v, wants IllegalMigrationVersionError", err)
+	}
+}
+
+func Test_Info_above_target(t *testing.T) {
+	records := []MigrationRecord{
+		{
+			Version:  "1",
+			Checksum: "3310d0ff858faac79e854454c9e403da",
+		},
+	}
+
+	migrations := []Migration{
+		{
+			Version:     "1",
+			Description: "First Migration",
+			Script:      "does not matter!",
+		},
+		{
+			Version:     "2",
+			Description: "Second Migration",
+			Script:      "does not matter!",
+		},
+		{
+			Version:     "3",
+			Description: "Third Migration",
+			Script:      "does not matter!",
+		},
+	}
+
+	d := New(&dummyDriver{records: records}, migrations, nil)
+	d.Target = "2"
+
+	info, _ := d.Info()
+
+	expected := []Status{Applied, Pending, AboveTarget}
+
+	for i, status := range expected {
+		if info[i].Status != status {
+			t.Errorf("info[%d].Status = %s, wants %s", i, info[i].Status, status)
+		}
+	}
+}
+
+func Test_Migrate_migrate_error(t *testing.T) {
+	driver := &dummyDriver{CreateError: true}
+	migrations := []Migration{}
+
+	err := Migrate(driver, migrations, nil)
+
+	if err == nil {
+		t.Error("Must emit error")
+	}
+}
+
+func Test_Migrate_with_error_in_Validate(t *testing.T) {
 	driver := &dummyDriver{AllError: true}
 	migrations := []Migration{}
 
@@ -378,7 +896,7 @@ func Test_Migrate_with_error_in_driver_insert(t *testing.T) {
 	driver := &dummyDriver{InsertError: true}
 	migrations := []Migration{
 		{
-			Version:     1,
+			Version:     "1",
 			Description: "First Migration",
 			Script:      "does not matter!",
 		},
@@ -395,7 +913,7 @@ func Test_Migrate_with_error_in_driver_exec(t *testing.T) {
 	driver := &dummyDriver{ExecError: true}
 	migrations := []Migration{
 		{
-			Version:     1,
+			Version:     "1",
 			Description: "First Migration",
 			Script:      "does not matter!",
 		},
@@ -405,8 +923,714 @@ func Test_Migrate_with_error_in_driver_exec(t *testing.T) {
 
 	all, _ := driver.All()
 
-	if len(all) != 0 {
-		t.Errorf("Must not apply all migrations")
+	if len(all) != 1 || !all[0].Failed || all[0].ErrorMessage != "Error" {
+		t.Errorf("Must record the failed migration")
+	}
+
+	driver.ExecError = false
+
+	err := Migrate(driver, migrations, nil)
+
+	if err != (FailedMigrationError{Version: "1", Message: "Error"}) {
+		t.Errorf("Must refuse to migrate until the failed migration is repaired, got %v", err)
+	}
+
+	if len(driver.records) != 1 {
+		t.Errorf("Must not apply migrations")
+	}
+}
+
+func Test_Info_failed_migration(t *testing.T) {
+	records := []MigrationRecord{
+		{
+			Version:      "1",
+			Failed:       true,
+			ErrorMessage: "syntax error",
+		},
+	}
+
+	migrations := []Migration{
+		{
+			Version:     "1",
+			Description: "First Migration",
+			Script:      "does not matter!",
+		},
+	}
+
+	infos, err := Info(&dummyDriver{records: records}, migrations)
+
+	if err != nil {
+		t.Fatal("Must not return error")
+	}
+
+	if infos[0].Status != Error || infos[0].Error == nil || infos[0].Error.Error() != "syntax error" {
+		t.Errorf("Expected %s with the stored error, got %s %v", Error, infos[0].Status, infos[0].Error)
+	}
+}
+
+func Test_Repair_failed_migration(t *testing.T) {
+	driver := &dummyDriver{ExecError: true}
+	migrations := []Migration{
+		{
+			Version:     "1",
+			Description: "First Migration",
+			Script:      "does not matter!",
+		},
+	}
+
+	d := New(driver, migrations, nil)
+	d.Migrate()
+
+	changes, err := d.Repair()
+
+	if err != nil {
+		t.Fatalf("Repair() error = %s, wants nil", err)
+	}
+
+	if len(changes) != 1 || changes[0].Action != RemovedFailed || changes[0].Record.Version != "1" {
+		t.Errorf("Must report the removed failed migration, got %v", changes)
+	}
+
+	driver.ExecError = false
+
+	if err := d.Migrate(); err != nil {
+		t.Errorf("Must migrate after repairing, got %s", err)
+	}
+
+	if len(driver.records) != 1 || driver.records[0].Failed {
+		t.Errorf("Must apply the repaired migration")
+	}
+}
+
+func Test_Repair_invalid_checksum(t *testing.T) {
+	records := []MigrationRecord{
+		{
+			Version:  "1.0",
+			Checksum: "3310d0ff858faac79e854454c9e403da",
+		},
+		{
+			Version:  "2.0",
+			Checksum: "3310d0ff858faac79e854454c9e403db",
+		},
+	}
+
+	migrations := []Migration{
+		{
+			Version:     "1.0",
+			Description: "Hello World",
+			Script:      "does not matter!",
+		},
+		{
+			Version:     "2.0",
+			Description: "Hello World",
+			Script:      "does not matter!",
+		},
+	}
+
+	d := New(&dummyDriver{records: records}, migrations, nil)
+
+	if _, ok := d.Validate().(InvalidChecksumError); !ok {
+		t.Fatal("Must not validate before repairing")
+	}
+
+	changes, err := d.Repair()
+
+	if err != nil {
+		t.Fatalf("Repair() error = %s, wants nil", err)
+	}
+
+	expected := RepairChange{
+		Action:   UpdatedChecksum,
+		Record:   MigrationRecord{Version: "2.0", Checksum: "3310d0ff858faac79e854454c9e403db"},
+		Checksum: "3310d0ff858faac79e854454c9e403da",
+	}
+
+	if len(changes) != 1 || changes[0] != expected {
+		t.Errorf("Must report the updated checksum, got %v", changes)
+	}
+
+	if err := d.Validate(); err != nil {
+		t.Errorf("Must validate after repairing, got %s", err)
+	}
+}
+
+func Test_RepairAction_String(t *testing.T) {
+	expectations := []struct {
+		action   RepairAction
+		expected string
+	}{
+		{RemovedFailed, "REMOVED FAILED"},
+		{UpdatedChecksum, "UPDATED CHECKSUM"},
+		{RepairAction(-1), "INVALID"},
+	}
+
+	for _, expectation := range expectations {
+		if expectation.expected != expectation.action.String() {
+			t.Errorf("Expected %s, got %s", expectation.expected, expectation.action.String())
+		}
+	}
+}
+
+func Test_Repair_not_supported(t *testing.T) {
+	_, err := New(&struct{ Driver }{&dummyDriver{}}, []Migration{}, nil).Repair()
+
+	if err != ErrRepairNotSupported {
+		t.Errorf("Repair() error = %v, wants ErrRepairNotSupported", err)
+	}
+}
+
+func Test_Migrate_func(t *testing.T) {
+	called := false
+	driver := &txDummyDriver{}
+	migrations := []Migration{
+		{
+			Version:     "1",
+			Description: "Backfill",
+			Func: func(ctx context.Context, tx *sql.Tx) error {
+				called = true
+				return nil
+			},
+			FuncChecksum: "v1",
+		},
+	}
+
+	if err := Migrate(driver, migrations, nil); err != nil {
+		t.Fatalf("Migrate() error = %s, wants nil", err)
+	}
+
+	if !called || len(driver.records) != 1 || driver.records[0].Checksum != "v1" {
+		t.Errorf("Must run the Go migration and record its checksum, got %v", driver.records)
+	}
+
+	migrations[0].FuncChecksum = "v2"
+
+	if _, ok := Validate(driver, migrations).(InvalidChecksumError); !ok {
+		t.Error("Must detect the changed Go migration")
+	}
+}
+
+func Test_Migrate_func_error(t *testing.T) {
+	driver := &txDummyDriver{}
+	migrations := []Migration{
+		{
+			Version:     "1",
+			Description: "Backfill",
+			Func: func(ctx context.Context, tx *sql.Tx) error {
+				return errors.New("Error")
+			},
+			FuncChecksum: "v1",
+		},
+	}
+
+	if err := Migrate(driver, migrations, nil); err == nil {
+		t.Fatal("Must fail when the Go migration fails")
+	}
+
+	if len(driver.records) != 1 || !driver.records[0].Failed {
+		t.Errorf("Must record the failed Go migration, got %v", driver.records)
+	}
+}
+
+func Test_Migrate_func_not_supported(t *testing.T) {
+	migrations := []Migration{
+		{Version: "1", Description: "Creating table posts", Script: "CREATE TABLE posts (id INT);"},
+		{
+			Version:      "2",
+			Description:  "Backfill",
+			Func:         func(ctx context.Context, tx *sql.Tx) error { return nil },
+			FuncChecksum: "v1",
+		},
+	}
+
+	driver := &dummyDriver{}
+
+	if err := Migrate(driver, migrations, nil); err != ErrFuncNotSupported {
+		t.Errorf("Migrate() error = %v, wants ErrFuncNotSupported", err)
+	}
+
+	if len(driver.records) != 0 {
+		t.Errorf("Must not apply or record any migration, got %v", driver.records)
+	}
+}
+
+func Test_Validate_missing_func_checksum(t *testing.T) {
+	migrations := []Migration{
+		{
+			Version:     "1",
+			Description: "Backfill",
+			Func:        func(ctx context.Context, tx *sql.Tx) error { return nil },
+		},
+	}
+
+	if _, ok := Validate(&dummyDriver{}, migrations).(MissingFuncChecksumError); !ok {
+		t.Error("Must require the checksum of Go migrations")
+	}
+}
+
+func Test_MissingFuncChecksumError_Error(t *testing.T) {
+	err := MissingFuncChecksumError{Version: "1.2"}
+
+	if err.Error() != "Missing checksum for the Go migration 1.2" {
+		t.Errorf("Unexpected error message %q", err.Error())
+	}
+}
+
+func Test_Migrate_repeatable(t *testing.T) {
+	driver := &dummyDriver{}
+	migrations := []Migration{
+		{
+			Description: "Posts view",
+			Script:      "CREATE OR REPLACE VIEW posts_view AS SELECT 1;",
+			Repeatable:  true,
+		},
+		{
+			Version:     "1",
+			Description: "First Migration",
+			Script:      "does not matter!",
+		},
+	}
+
+	d := New(driver, migrations, nil)
+
+	if err := d.Migrate(); err != nil {
+		t.Fatalf("Migrate() error = %s, wants nil", err)
+	}
+
+	if len(driver.records) != 2 || driver.records[1].Version != "" || driver.records[1].Description != "Posts view" {
+		t.Fatalf("Must apply the repeatable migration after the versioned ones, got %v", driver.records)
+	}
+
+	if err := d.Migrate(); err != nil || len(driver.records) != 2 {
+		t.Fatalf("Must not apply an unchanged repeatable migration, got %v", driver.records)
+	}
+
+	info, _ := d.Info()
+
+	if info[0].Status != Applied {
+		t.Errorf("info[0].Status = %s, wants APPLIED", info[0].Status)
+	}
+
+	migrations[0].Script = "CREATE OR REPLACE VIEW posts_view AS SELECT 2;"
+
+	if err := d.Validate(); err != nil {
+		t.Errorf("Changed repeatable migrations must be valid, got %s", err)
+	}
+
+	info, _ = d.Info()
+
+	if info[0].Status != Outdated {
+		t.Errorf("info[0].Status = %s, wants OUTDATED", info[0].Status)
+	}
+
+	if err := d.Migrate(); err != nil || len(driver.records) != 3 {
+		t.Fatalf("Must apply the changed repeatable migration, got %v", driver.records)
+	}
+
+	info, _ = d.Info()
+
+	if info[0].Status != Applied {
+		t.Errorf("info[0].Status = %s, wants APPLIED", info[0].Status)
+	}
+}
+
+func Test_Migrate_repeatable_error(t *testing.T) {
+	driver := &dummyDriver{ExecError: true}
+	migrations := []Migration{
+		{
+			Description: "Posts view",
+			Script:      "does not matter!",
+			Repeatable:  true,
+		},
+	}
+
+	if err := Migrate(driver, migrations, nil); err == nil {
+		t.Fatal("Must fail when the repeatable migration fails")
+	}
+
+	driver.ExecError = false
+
+	if err := Migrate(driver, migrations, nil); err != nil {
+		t.Errorf("Must apply the repeatable migration again without repairing, got %s", err)
+	}
+}
+
+func Test_Validate_repeatable(t *testing.T) {
+	migrations := []Migration{
+		{Description: "Posts view", Script: "does not matter!", Repeatable: true},
+		{Description: "Posts view", Script: "does not matter!", Repeatable: true},
+	}
+
+	if _, ok := Validate(&dummyDriver{}, migrations).(DuplicateRepeatableMigrationError); !ok {
+		t.Error("Must not accept repeatable migrations with the same description")
+	}
+
+	migrations = []Migration{
+		{Version: "1", Description: "Posts view", Script: "does not matter!", Repeatable: true},
+	}
+
+	if _, ok := Validate(&dummyDriver{}, migrations).(IllegalMigrationVersionError); !ok {
+		t.Error("Must not accept repeatable migrations with a version")
+	}
+}
+
+func Test_DuplicateRepeatableMigrationError_Error(t *testing.T) {
+	err := DuplicateRepeatableMigrationError{Description: "Posts view"}
+
+	if err.Error() != "Multiple repeatable migrations have the description \"Posts view\"." {
+		t.Errorf("Unexpected error message %q", err.Error())
+	}
+}
+
+func Test_Migrate_no_transaction(t *testing.T) {
+	driver := &txDummyDriver{}
+	migrations := []Migration{
+		{
+			Version:     "1",
+			Description: "First Migration",
+			Script:      "does not matter!",
+		},
+		{
+			Version:       "2",
+			Description:   "Concurrent index",
+			Script:        "CREATE INDEX CONCURRENTLY idx ON posts (id);",
+			NoTransaction: true,
+		},
+	}
+
+	infoChan := make(chan MigrationInfo, 2)
+
+	if err := Migrate(driver, migrations, infoChan); err != nil {
+		t.Fatalf("Migrate() error = %s, wants nil", err)
+	}
+
+	if driver.execNoTx != 1 || driver.execInserted != 1 || len(driver.records) != 2 {
+		t.Errorf("Must run only the second migration outside a transaction, got %d", driver.execNoTx)
+	}
+
+	if first, second := <-infoChan, <-infoChan; first.NoRollback || !second.NoRollback {
+		t.Error("Must report the migration without transaction as NoRollback")
+	}
+
+	info, _ := Info(driver, migrations)
+
+	if info[0].NoRollback || !info[1].NoRollback {
+		t.Errorf("Info must report the migration without transaction as NoRollback, got %v", info)
+	}
+}
+
+func Test_Migrate_no_transaction_error(t *testing.T) {
+	driver := &txDummyDriver{dummyDriver: dummyDriver{ExecError: true}}
+	migrations := []Migration{
+		{
+			Version:       "1",
+			Description:   "Concurrent index",
+			Script:        "CREATE INDEX CONCURRENTLY idx ON posts (id);",
+			NoTransaction: true,
+		},
+	}
+
+	err := Migrate(driver, migrations, nil)
+
+	if e, ok := err.(NoRollbackError); !ok || e.Version != "1" {
+		t.Fatalf("Migrate() error = %v, wants NoRollbackError", err)
+	}
+
+	info, _ := Info(driver, migrations)
+
+	if info[0].Status != Error || info[0].Error.Error() != err.Error() {
+		t.Errorf("Info must report that the failure was not rolled back, got %v", info[0].Error)
+	}
+}
+
+func Test_Migrate_no_transaction_not_supported(t *testing.T) {
+	migrations := []Migration{
+		{Version: "1", Description: "Creating table posts", Script: "CREATE TABLE posts (id INT);"},
+		{
+			Version:       "2",
+			Description:   "Concurrent index",
+			Script:        "CREATE INDEX CONCURRENTLY idx ON posts (id);",
+			NoTransaction: true,
+		},
+	}
+
+	driver := &dummyDriver{}
+
+	if err := Migrate(driver, migrations, nil); err != ErrNoTxNotSupported {
+		t.Errorf("Migrate() error = %v, wants ErrNoTxNotSupported", err)
+	}
+
+	if len(driver.records) != 0 {
+		t.Errorf("Must not apply or record any migration, got %v", driver.records)
+	}
+}
+
+func Test_NoRollbackError_Error(t *testing.T) {
+	cause := errors.New("Error")
+	err := NoRollbackError{Version: "1.2", Err: cause}
+
+	if err.Error() != "Migration 1.2 failed outside a transaction and was not rolled back: Error" {
+		t.Errorf("Unexpected error message %q", err.Error())
+	}
+
+	if !errors.Is(err, cause) {
+		t.Error("NoRollbackError must unwrap to the migration error")
+	}
+}
+
+func Test_Undo(t *testing.T) {
+	driver := &dummyDriver{}
+	migrations := []Migration{
+		{
+			Version:     "1",
+			Description: "First Migration",
+			Script:      "does not matter!",
+		},
+		{
+			Version:     "2",
+			Description: "Second Migration",
+			Script:      "does not matter!",
+			UndoScript:  "does not matter!",
+		},
+		{
+			Version:     "3",
+			Description: "Third Migration",
+			Script:      "does not matter!",
+			UndoScript:  "does not matter!",
+		},
+	}
+
+	d := New(driver, migrations, nil)
+	d.Migrate()
+
+	if err := d.Undo("1"); err != nil {
+		t.Fatalf("Undo() error = %s, wants nil", err)
+	}
+
+	if len(driver.records) != 1 || driver.records[0].Version != "1" {
+		t.Errorf("Must remove the undone migrations, got %v", driver.records)
+	}
+
+	info, _ := d.Info()
+
+	if info[1].Status != Pending || info[2].Status != Pending {
+		t.Errorf("The undone migrations must be pending, got %v", info)
+	}
+}
+
+func Test_Undo_missing_undo_script(t *testing.T) {
+	driver := &dummyDriver{}
+	migrations := []Migration{
+		{
+			Version:     "1",
+			Description: "First Migration",
+			Script:      "does not matter!",
+		},
+		{
+			Version:     "2",
+			Description: "Second Migration",
+			Script:      "does not matter!",
+			UndoScript:  "does not matter!",
+		},
+	}
+
+	d := New(driver, migrations, nil)
+	d.Migrate()
+
+	err := d.Undo("0")
+
+	if e, ok := err.(MissingUndoScriptError); !ok || e.Version != "1" {
+		t.Errorf("Undo() error = %v, wants MissingUndoScriptError for 1", err)
+	}
+
+	if len(driver.records) != 2 {
+		t.Errorf("Must not undo anything, got %v", driver.records)
+	}
+}
+
+func Test_Undo_baseline(t *testing.T) {
+	driver := &dummyDriver{}
+	d := New(driver, []Migration{}, nil)
+	d.Baseline("1", "Existing schema")
+
+	if _, ok := d.Undo("0").(MissingUndoScriptError); !ok {
+		t.Error("Must not undo the baseline")
+	}
+}
+
+func Test_Undo_invalid_version(t *testing.T) {
+	if _, ok := New(&dummyDriver{}, []Migration{}, nil).Undo("a").(IllegalMigrationVersionError); !ok {
+		t.Error("Must not undo to an invalid version")
+	}
+}
+
+func Test_Undo_not_supported(t *testing.T) {
+	err := New(&struct{ Driver }{&dummyDriver{}}, []Migration{}, nil).Undo("1")
+
+	if err != ErrUndoNotSupported {
+		t.Errorf("Undo() error = %v, wants ErrUndoNotSupported", err)
+	}
+}
+
+func Test_Undo_with_UndoDriver(t *testing.T) {
+	driver := &txDummyDriver{}
+	migrations := []Migration{
+		{
+			Version:     "1",
+			Description: "First Migration",
+			Script:      "does not matter!",
+			UndoScript:  "does not matter!",
+		},
+	}
+
+	d := New(driver, migrations, nil)
+	d.Migrate()
+
+	if err := d.Undo("0"); err != nil {
+		t.Fatalf("Undo() error = %s, wants nil", err)
+	}
+
+	if driver.execDeleted != 1 || len(driver.records) != 0 {
+		t.Errorf("Must prefer ExecDelete, called %d times", driver.execDeleted)
+	}
+}
+
+func Test_MissingUndoScriptError_Error(t *testing.T) {
+	err := MissingUndoScriptError{Version: "1.2"}
+
+	if err.Error() != "Migration 1.2 has no undo script" {
+		t.Errorf("Unexpected error message %q", err.Error())
+	}
+}
+
+func Test_Migrate_with_ExecInsert_only(t *testing.T) {
+	driver := &insertTxDummyDriver{}
+	migrations := []Migration{
+		{
+			Version:     "1",
+			Description: "First Migration",
+			Script:      "does not matter!",
+		},
+	}
+
+	if err := Migrate(driver, migrations, nil); err != nil {
+		t.Errorf("Must apply the migrations: %s", err)
+	}
+
+	if driver.execInserted != 1 {
+		t.Errorf("Must use ExecInsert without ExecDelete, called %d times", driver.execInserted)
+	}
+}
+
+func Test_Migrate_with_TxDriver(t *testing.T) {
+	driver := &txDummyDriver{}
+	migrations := []Migration{
+		{
+			Version:     "1",
+			Description: "First Migration",
+			Script:      "does not matter!",
+		},
+		{
+			Version:     "2",
+			Description: "Second Migration",
+			Script:      "does not matter!",
+		},
+	}
+
+	err := Migrate(driver, migrations, nil)
+
+	if err != nil {
+		t.Errorf("Must apply the migrations: %s", err)
+	}
+
+	if driver.execInserted != 2 {
+		t.Errorf("Must prefer ExecInsert, called %d times", driver.execInserted)
+	}
+}
+
+func Test_Migrate_with_lock(t *testing.T) {
+	driver := &lockingDriver{}
+	migrations := []Migration{
+		{
+			Version:     "1",
+			Description: "First Migration",
+			Script:      "does not matter!",
+		},
+	}
+
+	d := New(driver, migrations, nil)
+	d.LockTimeout = time.Second
+
+	err := d.Migrate()
+
+	if err != nil {
+		t.Errorf("Must apply the migrations holding the lock: %s", err)
+	}
+
+	if !driver.unlocked {
+		t.Error("Must release the lock")
+	}
+}
+
+func Test_Migrate_with_lock_timeout(t *testing.T) {
+	driver := &lockingDriver{LockError: true}
+	migrations := []Migration{
+		{
+			Version:     "1",
+			Description: "First Migration",
+			Script:      "does not matter!",
+		},
+	}
+
+	d := New(driver, migrations, nil)
+	d.LockTimeout = time.Second
+
+	err := d.Migrate()
+
+	if _, ok := err.(LockTimeoutError); !ok {
+		t.Errorf("Must return LockTimeoutError, got %v", err)
+	}
+
+	if len(driver.records) != 0 {
+		t.Error("Must not apply migrations without the lock")
+	}
+}
+
+func Test_MigrateContext_canceled(t *testing.T) {
+	driver := &dummyDriver{}
+	migrations := []Migration{
+		{
+			Version:     "1",
+			Description: "First Migration",
+			Script:      "does not matter!",
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := MigrateContext(ctx, driver, migrations, nil)
+
+	if err != context.Canceled {
+		t.Errorf("Must return context.Canceled, got %v", err)
+	}
+
+	if len(driver.records) != 0 {
+		t.Error("Must not apply migrations after the context is done")
+	}
+}
+
+func Test_ValidateContext_canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	d := New(&dummyDriver{}, []Migration{}, nil)
+
+	if err := d.ValidateContext(ctx); err != context.Canceled {
+		t.Errorf("Must return context.Canceled, got %v", err)
+	}
+
+	if _, err := d.InfoContext(ctx); err != context.Canceled {
+		t.Errorf("Must return context.Canceled, got %v", err)
 	}
 }
 
@@ -414,7 +1638,7 @@ func Test_planMigration_error_driver(t *testing.T) {
 	driver := &dummyDriver{AllError: true}
 	migrations := []Migration{}
 
-	_, err := planMigration(driver, migrations)
+	_, err := planMigration(context.Background(), driver, migrations, false, Darwin{}.validChecksum)
 
 	if err == nil {
 		t.Error("Must emit error")
@@ -424,12 +1648,12 @@ func Test_planMigration_error_driver(t *testing.T) {
 func Test_byMigrationVersion(t *testing.T) {
 	unordered := []Migration{
 		{
-			Version:     3,
+			Version:     "3",
 			Description: "Hello World",
 			Script:      "does not matter!",
 		},
 		{
-			Version:     1,
+			Version:     "1",
 			Description: "Hello World",
 			Script:      "does not matter!",
 		},
@@ -437,7 +1661,7 @@ func Test_byMigrationVersion(t *testing.T) {
 
 	sort.Sort(byMigrationVersion(unordered))
 
-	if unordered[0].Version != 1.0 {
+	if unordered[0].Version != "1" {
 		t.Errorf("Must order by version number")
 	}
 }
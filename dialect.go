@@ -1,5 +1,13 @@
 package darwin
 
+import (
+	"hash/fnv"
+	"strings"
+)
+
+// DefaultTableName is the name of the schema table when the dialect TableName is empty
+const DefaultTableName = "darwin_migrations"
+
 // Dialect is used to use multiple databases
 type Dialect interface {
 	// CreateTableSQL returns the SQL to create the schema table
@@ -10,4 +18,73 @@ type Dialect interface {
 
 	// AllSQL returns a SQL to get all entries in the table
 	AllSQL() string
+
+	// DeleteSQL returns the SQL to remove the entry of a version from the schema table
+	DeleteSQL() string
+
+	// UpdateChecksumSQL returns the SQL to replace the checksum of a version,
+	// the arguments are the checksum and the version
+	UpdateChecksumSQL() string
+}
+
+// AdvisoryLockDialect is implemented by dialects of databases supporting session
+// level advisory locks. The lock is released when the session is closed.
+type AdvisoryLockDialect interface {
+	// AdvisoryLockSQL returns a query that tries to acquire the lock without
+	// waiting, returning a single row with true if the lock was acquired
+	AdvisoryLockSQL() string
+
+	// AdvisoryUnlockSQL returns the SQL to release the lock
+	AdvisoryUnlockSQL() string
+}
+
+// LockTableDialect is implemented by dialects of databases without advisory
+// locks. The lock is held while a row exists in the lock table, a process
+// killed while holding it leaves the row, see GenericDriver.ForceUnlock.
+type LockTableDialect interface {
+	// CreateLockTableSQL returns the SQL to create the lock table
+	CreateLockTableSQL() string
+
+	// InsertLockSQL returns the SQL to insert the lock row, it must affect no
+	// rows when the lock is already held
+	InsertLockSQL() string
+
+	// DeleteLockSQL returns the SQL to remove the lock row
+	DeleteLockSQL() string
+}
+
+// noTxDialect is implemented by the dialects telling whether the database
+// can run statements outside a transaction, the others can
+type noTxDialect interface {
+	noTx() bool
+}
+
+// advisoryLockKey returns a numeric lock key for the given name
+func advisoryLockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+// tableName returns name or DefaultTableName if it is empty
+func tableName(name string) string {
+	if name == "" {
+		return DefaultTableName
+	}
+
+	return name
+}
+
+// qualifiedName quotes table and prefixes it with the quoted schema, if any
+func qualifiedName(schema, table, quote string) string {
+	if schema == "" {
+		return quoteIdentifier(table, quote)
+	}
+
+	return quoteIdentifier(schema, quote) + "." + quoteIdentifier(table, quote)
+}
+
+// quoteIdentifier quotes name, doubling the quotes inside it
+func quoteIdentifier(name, quote string) string {
+	return quote + strings.Replace(name, quote, quote+quote, -1) + quote
 }
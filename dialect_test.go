@@ -0,0 +1,56 @@
+package darwin
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_Dialect_table_name(t *testing.T) {
+	expectations := []struct {
+		dialect  Dialect
+		expected string
+	}{
+		{MySQLDialect{}, "INTO `darwin_migrations`"},
+		{MySQLDialect{TableName: "plugin`migrations", Schema: "admin"}, "INTO `admin`.`plugin``migrations`"},
+		{PostgresDialect{}, `INTO "darwin_migrations"`},
+		{PostgresDialect{TableName: "plugin_migrations", Schema: "admin"}, `INTO "admin"."plugin_migrations"`},
+		{PostgresDialect{TableName: `plugin"migrations`}, `INTO "plugin""migrations"`},
+		{SqliteDialect{}, `INTO "darwin_migrations"`},
+		{SqliteDialect{TableName: "plugin_migrations", Schema: "aux"}, `INTO "aux"."plugin_migrations"`},
+		{QLDialect{}, "INTO darwin_migrations"},
+		{QLDialect{TableName: "plugin_migrations"}, "INTO plugin_migrations"},
+	}
+
+	for _, expectation := range expectations {
+		if !strings.Contains(expectation.dialect.InsertSQL(), expectation.expected) {
+			t.Errorf("%T.InsertSQL() = %s, wants %s", expectation.dialect, expectation.dialect.InsertSQL(), expectation.expected)
+		}
+	}
+}
+
+func Test_Dialect_lock_per_table(t *testing.T) {
+	if (PostgresDialect{}).AdvisoryLockSQL() == (PostgresDialect{TableName: "plugin_migrations"}).AdvisoryLockSQL() {
+		t.Error("Must use a different PostgreSQL advisory lock for each table")
+	}
+
+	if (MySQLDialect{}).AdvisoryLockSQL() == (MySQLDialect{Schema: "admin"}).AdvisoryLockSQL() {
+		t.Error("Must use a different MySQL lock for each table")
+	}
+
+	if !strings.Contains((SqliteDialect{TableName: "plugin_migrations"}).InsertLockSQL(), `"plugin_migrations_lock"`) {
+		t.Error("Must use a different lock table for each table")
+	}
+}
+
+func Test_MySQLDialect_UpgradeSQL_guarded(t *testing.T) {
+	dialect := MySQLDialect{}
+
+	// MySQL commits each ALTER TABLE, a step must be able to run again
+	for version := 1; version < SchemaVersion; version++ {
+		for _, stmt := range dialect.SplitStatements(dialect.UpgradeSQL(version)) {
+			if strings.HasPrefix(stmt, "ALTER TABLE") && (strings.Contains(stmt, "ADD") || strings.Contains(stmt, "DROP")) {
+				t.Errorf("UpgradeSQL(%d) adds or drops without a guard: %s", version, stmt)
+			}
+		}
+	}
+}
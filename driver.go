@@ -1,18 +1,65 @@
 package darwin
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"sync"
 	"time"
 )
 
 // MigrationRecord is the entry in schema table
 type MigrationRecord struct {
-	Version       float64
-	Description   string
-	Checksum      string
-	AppliedAt     time.Time
+	Version     Version
+	Description string
+	Checksum    string
+
+	// AppliedAt is stored in UTC with microsecond precision, the precision
+	// of PostgreSQL and MySQL
+	AppliedAt time.Time
+
+	// ExecutionTime is stored in nanoseconds
 	ExecutionTime time.Duration
+
+	// Failed is true when the migration could not be applied, it is
+	// stored as the success column of the schema table
+	Failed       bool
+	ErrorMessage string
+
+	// Baseline is true for the entry inserted by Baseline, the migrations up
+	// to its version are considered applied
+	Baseline bool
+
+	// InstalledBy is who applied the migration, see Darwin.InstalledBy. The
+	// dialects of databases with users store the database user when empty.
+	InstalledBy string
+
+	// Hostname is the host where the migration was applied
+	Hostname string
+
+	// AppVersion is the version of the application that applied the
+	// migration, see Darwin.AppVersion
+	AppVersion string
+
+	// Rank is the position of the entry in the order the migrations were
+	// applied, starting at 1. It is set by the database when inserted.
+	Rank int
+}
+
+// ScanError is used to report a row of the schema table that could not be read
+type ScanError struct {
+	// Row is the position of the row in the result of AllSQL, starting at 1
+	Row int
+	Err error
+}
+
+func (s ScanError) Error() string {
+	return fmt.Sprintf("Cannot read row %d of the schema table: %s", s.Row, s.Err)
+}
+
+// Unwrap returns the error returned by database/sql
+func (s ScanError) Unwrap() error {
+	return s.Err
 }
 
 // Driver a database driver abstraction
@@ -23,10 +70,86 @@ type Driver interface {
 	Exec(string) (time.Duration, error)
 }
 
+// DriverContext is implemented by drivers supporting cancellation through
+// context.Context. When a Driver does not implement it, the context is only
+// checked before each call.
+type DriverContext interface {
+	CreateContext(ctx context.Context) error
+	InsertContext(ctx context.Context, e MigrationRecord) error
+	AllContext(ctx context.Context) ([]MigrationRecord, error)
+	ExecContext(ctx context.Context, script string) (time.Duration, error)
+}
+
+// TxDriver is implemented by drivers able to execute a migration script and
+// change its MigrationRecord in the same transaction.
+type TxDriver interface {
+	// ExecInsert executes the script and inserts e, the ExecutionTime of e
+	// is set by the driver
+	ExecInsert(ctx context.Context, script string, e MigrationRecord) error
+}
+
+// UndoDriver is implemented by drivers able to execute an undo script and
+// remove the entry of its migration in the same transaction, see Undo
+type UndoDriver interface {
+	// ExecDelete executes the undo script and removes the entry of the
+	// migration version
+	ExecDelete(ctx context.Context, script string, version Version) error
+}
+
+// FuncDriver is implemented by drivers able to run Go migrations
+type FuncDriver interface {
+	// ExecFuncInsert calls f and inserts e in the same transaction, the
+	// ExecutionTime of e is set by the driver
+	ExecFuncInsert(ctx context.Context, f MigrationFunc, e MigrationRecord) error
+}
+
+// NoTxDriver is implemented by drivers able to run a script outside a
+// transaction, see Migration.NoTransaction
+type NoTxDriver interface {
+	// ExecNoTx executes the script without a transaction
+	ExecNoTx(ctx context.Context, script string) (time.Duration, error)
+}
+
+// noTxChecker is implemented by the NoTxDrivers able to run scripts outside
+// a transaction only with some databases
+type noTxChecker interface {
+	supportsNoTx() bool
+}
+
+// RepairDriver is implemented by drivers able to fix the schema table, see Repair
+type RepairDriver interface {
+	// Delete removes the entry of the migration version
+	Delete(ctx context.Context, version Version) error
+
+	// UpdateChecksum replaces the checksum of the migration version
+	UpdateChecksum(ctx context.Context, version Version, checksum string) error
+}
+
+// Locker is implemented by drivers able to hold a lock shared by every process
+// migrating the same database.
+type Locker interface {
+	// Lock blocks until the lock is acquired, returning a LockTimeoutError if
+	// it could not be acquired in timeout. A zero timeout waits forever.
+	Lock(ctx context.Context, timeout time.Duration) error
+
+	// Unlock releases the lock acquired by Lock
+	Unlock() error
+}
+
+// lockRetryInterval is the time to wait between attempts to acquire a lock
+var lockRetryInterval = time.Second
+
 // GenericDriver is the default Driver, it can be configured to any database.
 type GenericDriver struct {
 	DB      *sql.DB
 	Dialect Dialect
+
+	// mu guards conn, the driver may be used by many goroutines
+	mu sync.Mutex
+
+	// conn is the session holding the advisory lock, it is used instead of
+	// DB by the work done holding the lock
+	conn *sql.Conn
 }
 
 // NewGenericDriver creates a new GenericDriver configured with db and dialect.
@@ -45,8 +168,19 @@ func NewGenericDriver(db *sql.DB, dialect Dialect) *GenericDriver {
 
 // Create create the table darwin_migrations if necessary
 func (m *GenericDriver) Create() error {
-	err := transaction(m.DB, func(tx *sql.Tx) error {
-		_, err := tx.Exec(m.Dialect.CreateTableSQL())
+	return m.CreateContext(context.Background())
+}
+
+// CreateContext create the table darwin_migrations if necessary. When the
+// Dialect is an UpgradeDialect, a schema table created by an older release
+// is upgraded to SchemaVersion.
+func (m *GenericDriver) CreateContext(ctx context.Context) error {
+	if dialect, ok := m.Dialect.(UpgradeDialect); ok {
+		return m.createVersioned(ctx, dialect)
+	}
+
+	err := transactionContext(ctx, m.session(ctx), func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, m.Dialect.CreateTableSQL())
 		return err
 	})
 
@@ -55,85 +189,530 @@ func (m *GenericDriver) Create() error {
 
 // Insert insert a migration entry into database
 func (m *GenericDriver) Insert(e MigrationRecord) error {
+	return m.InsertContext(context.Background(), e)
+}
 
-	err := transaction(m.DB, func(tx *sql.Tx) error {
-		_, err := tx.Exec(m.Dialect.InsertSQL(),
-			e.Version,
-			e.Description,
-			e.Checksum,
-			e.AppliedAt.Unix(),
-			e.ExecutionTime,
-		)
-		return err
+// InsertContext insert a migration entry into database
+func (m *GenericDriver) InsertContext(ctx context.Context, e MigrationRecord) error {
+
+	err := transactionContext(ctx, m.session(ctx), func(tx *sql.Tx) error {
+		return m.insert(ctx, tx, e)
 	})
 
 	return err
 }
 
+func (m *GenericDriver) insert(ctx context.Context, tx *sql.Tx, e MigrationRecord) error {
+	_, err := tx.ExecContext(ctx, m.Dialect.InsertSQL(), insertArgs(e)...)
+	return err
+}
+
+// insertArgs returns the arguments of the Dialect InsertSQL
+func insertArgs(e MigrationRecord) []interface{} {
+	return []interface{}{
+		string(e.Version),
+		e.Description,
+		e.Checksum,
+		appliedAt(e.AppliedAt),
+		int64(e.ExecutionTime),
+		!e.Failed,
+		e.ErrorMessage,
+		e.Baseline,
+		e.InstalledBy,
+		e.Hostname,
+		e.AppVersion,
+	}
+}
+
+// appliedAt returns t as stored in the schema table
+func appliedAt(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Microsecond)
+}
+
+// timeValue scans the applied_at column, database drivers return it as a
+// time.Time or, like MySQL without parseTime, as text
+type timeValue struct {
+	time time.Time
+}
+
+// timeLayouts are the layouts of the timestamps returned as text, without
+// zone they are in UTC
+var timeLayouts = []string{
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+}
+
+// Scan implements the sql.Scanner interface
+func (t *timeValue) Scan(src interface{}) error {
+	var text string
+
+	switch src := src.(type) {
+	case time.Time:
+		t.time = src.UTC()
+		return nil
+	case []byte:
+		text = string(src)
+	case string:
+		text = src
+	default:
+		return fmt.Errorf("darwin: cannot scan %T into applied_at", src)
+	}
+
+	for _, layout := range timeLayouts {
+		if parsed, err := time.Parse(layout, text); err == nil {
+			t.time = parsed.UTC()
+			return nil
+		}
+	}
+
+	return fmt.Errorf("darwin: cannot parse applied_at %q", text)
+}
+
 // All returns all migrations applied
 func (m *GenericDriver) All() ([]MigrationRecord, error) {
+	return m.AllContext(context.Background())
+}
+
+// AllContext returns all migrations applied
+func (m *GenericDriver) AllContext(ctx context.Context) ([]MigrationRecord, error) {
 	entries := []MigrationRecord{}
 
-	rows, err := m.DB.Query(m.Dialect.AllSQL())
+	rows, err := m.session(ctx).QueryContext(ctx, m.Dialect.AllSQL())
 
 	if err != nil {
 		return []MigrationRecord{}, err
 	}
 
+	defer rows.Close()
+
 	for rows.Next() {
 		var (
-			version       float64
+			version       string
 			description   string
 			checksum      string
-			appliedAt     int64
-			executionTime float64
+			appliedAt     timeValue
+			executionTime int64
+			success       bool
+			errorMessage  string
+			baseline      bool
+			installedBy   string
+			hostname      string
+			appVersion    string
+			rank          int
 		)
 
-		rows.Scan(
+		err := rows.Scan(
 			&version,
 			&description,
 			&checksum,
 			&appliedAt,
 			&executionTime,
+			&success,
+			&errorMessage,
+			&baseline,
+			&installedBy,
+			&hostname,
+			&appVersion,
+			&rank,
 		)
 
+		if err != nil {
+			return []MigrationRecord{}, ScanError{Row: len(entries) + 1, Err: err}
+		}
+
 		entry := MigrationRecord{
-			Version:       version,
+			Version:       Version(version),
 			Description:   description,
 			Checksum:      checksum,
-			AppliedAt:     time.Unix(appliedAt, 0),
+			AppliedAt:     appliedAt.time,
 			ExecutionTime: time.Duration(executionTime),
+			Failed:        !success,
+			ErrorMessage:  errorMessage,
+			Baseline:      baseline,
+			InstalledBy:   installedBy,
+			Hostname:      hostname,
+			AppVersion:    appVersion,
+			Rank:          rank,
 		}
 
 		entries = append(entries, entry)
 	}
 
-	rows.Close()
+	// A failure fetching the rows, like a dropped connection, stops Next
+	if err := rows.Err(); err != nil {
+		return []MigrationRecord{}, ScanError{Row: len(entries) + 1, Err: err}
+	}
 
 	return entries, nil
 }
 
 // Exec execute sql scripts into database
 func (m *GenericDriver) Exec(script string) (time.Duration, error) {
+	return m.ExecContext(context.Background(), script)
+}
+
+// ExecContext execute sql scripts into database
+func (m *GenericDriver) ExecContext(ctx context.Context, script string) (time.Duration, error) {
 	start := time.Now()
 
-	err := transaction(m.DB, func(tx *sql.Tx) error {
-		_, err := tx.Exec(script)
-		return err
+	err := transactionContext(ctx, m.session(ctx), func(tx *sql.Tx) error {
+		return m.execScript(ctx, tx, script)
 	})
 
 	return time.Since(start), err
 }
 
+// ExecNoTx executes the script outside a transaction, each statement is
+// committed as soon as it is executed. It returns ErrNoTxNotSupported when
+// the database changes nothing outside a transaction, like QL.
+func (m *GenericDriver) ExecNoTx(ctx context.Context, script string) (time.Duration, error) {
+	if !m.supportsNoTx() {
+		return 0, ErrNoTxNotSupported
+	}
+
+	start := time.Now()
+	err := m.execScript(ctx, m.session(ctx), script)
+
+	return time.Since(start), err
+}
+
+// supportsNoTx reports whether the Dialect can run scripts outside a
+// transaction, see noTxDialect
+func (m *GenericDriver) supportsNoTx() bool {
+	dialect, ok := m.Dialect.(noTxDialect)
+
+	return !ok || dialect.noTx()
+}
+
+// session is implemented by *sql.DB and *sql.Conn
+type session interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// session returns the connection holding the advisory lock when ctx is of the
+// work done holding it, so it does not wait for another connection of a
+// limited pool, or DB
+func (m *GenericDriver) session(ctx context.Context) session {
+	if !lockHeld(ctx) {
+		return m.DB
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.conn != nil {
+		return m.conn
+	}
+
+	return m.DB
+}
+
+// execer is implemented by *sql.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// execScript executes the script with e, statement by statement when the
+// Dialect is a SplitDialect
+func (m *GenericDriver) execScript(ctx context.Context, e execer, script string) error {
+	splitter, ok := m.Dialect.(SplitDialect)
+
+	if !ok {
+		_, err := e.ExecContext(ctx, script)
+		return err
+	}
+
+	for i, stmt := range splitter.SplitStatements(script) {
+		if _, err := e.ExecContext(ctx, stmt); err != nil {
+			return StatementError{Index: i + 1, Statement: stmt, Err: err}
+		}
+	}
+
+	return nil
+}
+
+// ExecInsert executes the script and inserts the migration entry in the same
+// transaction, so a failure leaves neither the schema change nor the entry.
+// Databases without transactional DDL, like MySQL, commit the script anyway.
+func (m *GenericDriver) ExecInsert(ctx context.Context, script string, e MigrationRecord) error {
+	return m.ExecFuncInsert(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		return m.execScript(ctx, tx, script)
+	}, e)
+}
+
+// ExecFuncInsert calls the Go migration f and inserts the migration entry in
+// the same transaction, like ExecInsert
+func (m *GenericDriver) ExecFuncInsert(ctx context.Context, f MigrationFunc, e MigrationRecord) error {
+	return transactionContext(ctx, m.session(ctx), func(tx *sql.Tx) error {
+		start := time.Now()
+
+		if err := f(ctx, tx); err != nil {
+			return err
+		}
+
+		e.ExecutionTime = time.Since(start)
+
+		return m.insert(ctx, tx, e)
+	})
+}
+
+// ExecDelete executes the undo script and removes the migration entry in the
+// same transaction
+func (m *GenericDriver) ExecDelete(ctx context.Context, script string, version Version) error {
+	return transactionContext(ctx, m.session(ctx), func(tx *sql.Tx) error {
+		if err := m.execScript(ctx, tx, script); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, m.Dialect.DeleteSQL(), string(version))
+		return err
+	})
+}
+
+// Delete removes the entry of the migration version from the schema table
+func (m *GenericDriver) Delete(ctx context.Context, version Version) error {
+	return transactionContext(ctx, m.session(ctx), func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, m.Dialect.DeleteSQL(), string(version))
+		return err
+	})
+}
+
+// UpdateChecksum replaces the checksum of the migration version in the schema table
+func (m *GenericDriver) UpdateChecksum(ctx context.Context, version Version, checksum string) error {
+	return transactionContext(ctx, m.session(ctx), func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, m.Dialect.UpdateChecksumSQL(), checksum, string(version))
+		return err
+	})
+}
+
+// Lock acquires the migration lock using the Dialect, see AdvisoryLockDialect
+// and LockTableDialect. Dialects implementing none of them are not locked.
+// While Migrate and the other methods of Darwin hold an advisory lock, their
+// queries run on its connection, so a DB limited by SetMaxOpenConns(1) does
+// not deadlock.
+func (m *GenericDriver) Lock(ctx context.Context, timeout time.Duration) error {
+	switch dialect := m.Dialect.(type) {
+	case AdvisoryLockDialect:
+		return m.advisoryLock(ctx, dialect, timeout)
+	case LockTableDialect:
+		return m.tableLock(ctx, dialect, timeout)
+	}
+
+	return nil
+}
+
+// Unlock releases the migration lock acquired by Lock. It does not take a
+// context because the lock must be released even when the migration was cancelled
+func (m *GenericDriver) Unlock() error {
+	switch dialect := m.Dialect.(type) {
+	case AdvisoryLockDialect:
+		m.mu.Lock()
+		conn := m.conn
+		m.conn = nil
+		m.mu.Unlock()
+
+		if conn == nil {
+			return nil
+		}
+
+		_, err := conn.ExecContext(context.Background(), dialect.AdvisoryUnlockSQL())
+		conn.Close()
+
+		return err
+	case LockTableDialect:
+		return transaction(m.DB, func(tx *sql.Tx) error {
+			_, err := tx.Exec(dialect.DeleteLockSQL())
+			return err
+		})
+	}
+
+	return nil
+}
+
+// ForceUnlock removes the lock row left in the lock table by a process killed
+// while holding the lock, see LockTableDialect. Make sure no other process is
+// migrating. Advisory locks need no force, the database releases them when
+// the session of the process ends.
+func (m *GenericDriver) ForceUnlock(ctx context.Context) error {
+	dialect, ok := m.Dialect.(LockTableDialect)
+
+	if !ok {
+		return nil
+	}
+
+	return transactionContext(ctx, m.session(ctx), func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, dialect.CreateLockTableSQL()); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, dialect.DeleteLockSQL())
+		return err
+	})
+}
+
+// advisoryLock holds a connection because the advisory locks belong to the session
+func (m *GenericDriver) advisoryLock(ctx context.Context, dialect AdvisoryLockDialect, timeout time.Duration) error {
+	conn, err := m.DB.Conn(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	err = retryLock(ctx, timeout, func() (bool, error) {
+		var acquired bool
+		err := conn.QueryRowContext(ctx, dialect.AdvisoryLockSQL()).Scan(&acquired)
+		return acquired, err
+	})
+
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	m.mu.Lock()
+	m.conn = conn
+	m.mu.Unlock()
+
+	return nil
+}
+
+func (m *GenericDriver) tableLock(ctx context.Context, dialect LockTableDialect, timeout time.Duration) error {
+	err := transactionContext(ctx, m.DB, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, dialect.CreateLockTableSQL())
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return retryLock(ctx, timeout, func() (bool, error) {
+		var affected int64
+
+		err := transactionContext(ctx, m.DB, func(tx *sql.Tx) error {
+			result, err := tx.ExecContext(ctx, dialect.InsertLockSQL())
+
+			if err != nil {
+				return err
+			}
+
+			affected, err = result.RowsAffected()
+			return err
+		})
+
+		return affected == 1, err
+	})
+}
+
+// retryLock calls try until it acquires the lock, fails, the timeout expires
+// or ctx is done
+func retryLock(ctx context.Context, timeout time.Duration, try func() (bool, error)) error {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		acquired, err := try()
+
+		if err != nil {
+			return err
+		}
+
+		if acquired {
+			return nil
+		}
+
+		wait := lockRetryInterval
+
+		if timeout > 0 {
+			remaining := time.Until(deadline)
+
+			if remaining <= 0 {
+				return LockTimeoutError{Timeout: timeout}
+			}
+
+			if remaining < wait {
+				wait = remaining
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// createContext calls CreateContext if d is a DriverContext
+func createContext(ctx context.Context, d Driver) error {
+	if dc, ok := d.(DriverContext); ok {
+		return dc.CreateContext(ctx)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return d.Create()
+}
+
+// insertContext calls InsertContext if d is a DriverContext
+func insertContext(ctx context.Context, d Driver, e MigrationRecord) error {
+	if dc, ok := d.(DriverContext); ok {
+		return dc.InsertContext(ctx, e)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return d.Insert(e)
+}
+
+// allContext calls AllContext if d is a DriverContext
+func allContext(ctx context.Context, d Driver) ([]MigrationRecord, error) {
+	if dc, ok := d.(DriverContext); ok {
+		return dc.AllContext(ctx)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return []MigrationRecord{}, err
+	}
+
+	return d.All()
+}
+
+// execContext calls ExecContext if d is a DriverContext
+func execContext(ctx context.Context, d Driver, script string) (time.Duration, error) {
+	if dc, ok := d.(DriverContext); ok {
+		return dc.ExecContext(ctx, script)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return d.Exec(script)
+}
+
 // transaction is a utility function to execute the SQL inside a transaction
 // Panic if db is nil
 // see: http://stackoverflow.com/a/23502629
-func transaction(db *sql.DB, f func(*sql.Tx) error) (err error) {
-	if db == nil {
+func transaction(db *sql.DB, f func(*sql.Tx) error) error {
+	return transactionContext(context.Background(), db, f)
+}
+
+// transactionContext is like transaction, but the transaction is rolled back
+// when ctx is done
+func transactionContext(ctx context.Context, s session, f func(*sql.Tx) error) (err error) {
+	if db, ok := s.(*sql.DB); s == nil || ok && db == nil {
 		panic("darwin: sql.DB is nil")
 	}
 
-	tx, err := db.Begin()
+	tx, err := s.BeginTx(ctx, nil)
 
 	if err != nil {
 		return
@@ -162,4 +741,4 @@ type byMigrationRecordVersion []MigrationRecord
 
 func (b byMigrationRecordVersion) Len() int           { return len(b) }
 func (b byMigrationRecordVersion) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
-func (b byMigrationRecordVersion) Less(i, j int) bool { return b[i].Version < b[j].Version }
+func (b byMigrationRecordVersion) Less(i, j int) bool { return b[i].Version.Compare(b[j].Version) < 0 }
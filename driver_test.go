@@ -1,8 +1,11 @@
 package darwin
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
+	"io"
 	"regexp"
 	"sort"
 	"strings"
@@ -48,19 +51,601 @@ func Test_GenericDriver_Create(t *testing.T) {
 
 	dialect := MySQLDialect{}
 
+	expectSchemaVersion(mock, dialect, nil)
+
+	// The schema table is created holding the lock
+	mock.ExpectQuery(escapeQuery(dialect.AdvisoryLockSQL())).
+		WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+	mock.ExpectQuery(escapeQuery(dialect.SchemaVersionSQL())).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(nil))
+	mock.ExpectQuery(escapeQuery(dialect.ColumnsSQL())).
+		WillReturnRows(sqlmock.NewRows([]string{"column_name"}))
+	mock.ExpectBegin()
+	expectScript(mock, dialect, dialect.CreateTableSQL())
+	mock.ExpectExec(escapeQuery(dialect.InsertSchemaVersionSQL())).
+		WithArgs(SchemaVersion).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec(escapeQuery(dialect.AdvisoryUnlockSQL())).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	d := NewGenericDriver(db, dialect)
+
+	if err := d.Create(); err != nil {
+		t.Errorf("Create() error = %s, wants nil", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+func Test_GenericDriver_Create_up_to_date(t *testing.T) {
+	db, mock, err := sqlmock.New()
+
+	if err != nil {
+		t.Errorf("sqlmock.New().error != nil, wants nil")
+	}
+
+	defer db.Close()
+
+	dialect := MySQLDialect{}
+
+	expectSchemaVersion(mock, dialect, SchemaVersion)
+
+	d := NewGenericDriver(db, dialect)
+
+	if err := d.Create(); err != nil {
+		t.Errorf("Create() error = %s, wants nil", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+func Test_GenericDriver_Create_current_table(t *testing.T) {
+	db, mock, err := sqlmock.New()
+
+	if err != nil {
+		t.Errorf("sqlmock.New().error != nil, wants nil")
+	}
+
+	defer db.Close()
+
+	dialect := MySQLDialect{}
+
+	// Created by CreateTableSQL without storing the version
+	expectSchemaVersion(mock, dialect, nil,
+		"id", "version", "description", "checksum", "applied_at", "execution_time", "success", "error_message",
+		"baseline", "installed_by", "hostname", "app_version", "installed_rank")
+
+	d := NewGenericDriver(db, dialect)
+
+	if err := d.Create(); err != nil {
+		t.Errorf("Create() error = %s, wants nil", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+func Test_GenericDriver_Create_upgrade(t *testing.T) {
+	db, mock, err := sqlmock.New()
+
+	if err != nil {
+		t.Errorf("sqlmock.New().error != nil, wants nil")
+	}
+
+	defer db.Close()
+
+	dialect := MySQLDialect{}
+
+	// The lock is already held by Migrate
+	expectSchemaVersion(mock, dialect, nil, "id", "version", "description", "checksum", "applied_at", "execution_time")
+
+	for version := 1; version < SchemaVersion; version++ {
+		mock.ExpectBegin()
+		expectScript(mock, dialect, dialect.UpgradeSQL(version))
+		mock.ExpectExec(escapeQuery(dialect.InsertSchemaVersionSQL())).
+			WithArgs(version + 1).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+	}
+
+	d := NewGenericDriver(db, dialect)
+	ctx := context.WithValue(context.Background(), lockHeldKey{}, true)
+
+	if err := d.CreateContext(ctx); err != nil {
+		t.Errorf("Create() error = %s, wants nil", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+func Test_GenericDriver_Create_newer_version(t *testing.T) {
+	db, mock, err := sqlmock.New()
+
+	if err != nil {
+		t.Errorf("sqlmock.New().error != nil, wants nil")
+	}
+
+	defer db.Close()
+
+	dialect := MySQLDialect{}
+
+	expectSchemaVersion(mock, dialect, SchemaVersion+1)
+
+	d := NewGenericDriver(db, dialect)
+	ctx := context.WithValue(context.Background(), lockHeldKey{}, true)
+
+	err = d.CreateContext(ctx)
+
+	if err != (SchemaVersionError{Version: SchemaVersion + 1}) {
+		t.Errorf("Create() error = %v, wants SchemaVersionError", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+// expectScript expects the statements of script to be executed
+func expectScript(mock sqlmock.Sqlmock, dialect SplitDialect, script string) {
+	for _, stmt := range dialect.SplitStatements(script) {
+		mock.ExpectExec(escapeQuery(stmt)).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+}
+
+// expectSchemaVersion expects the schema version table to be created and
+// queried, returning version. The columns of the schema table are queried
+// when version is nil.
+func expectSchemaVersion(mock sqlmock.Sqlmock, dialect UpgradeDialect, version interface{}, columns ...string) {
+	mock.ExpectBegin()
+	mock.ExpectExec(escapeQuery(dialect.CreateSchemaVersionTableSQL())).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectQuery(escapeQuery(dialect.SchemaVersionSQL())).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(version))
+
+	if version == nil {
+		rows := sqlmock.NewRows([]string{"column_name"})
+
+		for _, column := range columns {
+			rows.AddRow(column)
+		}
+
+		mock.ExpectQuery(escapeQuery(dialect.ColumnsSQL())).WillReturnRows(rows)
+	}
+}
+
+func Test_GenericDriver_Insert(t *testing.T) {
+	db, mock, err := sqlmock.New()
+
+	if err != nil {
+		t.Errorf("sqlmock.New().error != nil, wants nil")
+	}
+
+	defer db.Close()
+
+	record := MigrationRecord{
+		Version:       "1.0",
+		Description:   "Description",
+		Checksum:      "7ebca1c6f05333a728a8db4629e8d543",
+		AppliedAt:     time.Now(),
+		ExecutionTime: time.Millisecond * 1,
+		InstalledBy:   "deploy",
+		Hostname:      "ci-1",
+		AppVersion:    "2.3.0",
+	}
+
+	dialect := MySQLDialect{}
+
+	d := NewGenericDriver(db, dialect)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(escapeQuery(dialect.InsertSQL())).
+		WithArgs(
+			record.Version,
+			record.Description,
+			record.Checksum,
+			appliedAt(record.AppliedAt),
+			int64(record.ExecutionTime),
+			true,
+			"",
+			false,
+			"deploy",
+			"ci-1",
+			"2.3.0",
+		).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	mock.ExpectCommit()
+
+	d.Insert(record)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+func Test_GenericDriver_All_success(t *testing.T) {
+	db, mock, err := sqlmock.New()
+
+	if err != nil {
+		t.Errorf("sqlmock.New().error != nil, wants nil")
+	}
+
+	defer db.Close()
+
+	dialect := MySQLDialect{}
+
+	d := NewGenericDriver(db, dialect)
+
+	rows := sqlmock.NewRows([]string{
+		"version", "description", "checksum", "applied_at", "execution_time", "success", "error_message", "baseline",
+		"installed_by", "hostname", "app_version", "installed_rank",
+	}).AddRow(
+		1, "Description", "7ebca1c6f05333a728a8db4629e8d543",
+		time.Now(),
+		int64(time.Millisecond), true, "", false,
+		"deploy", "ci-1", "2.3.0", 7,
+	)
+
+	mock.ExpectQuery(escapeQuery(dialect.AllSQL())).
+		WillReturnRows(rows)
+
+	migrations, err := d.All()
+
+	if err != nil || len(migrations) != 1 {
+		t.Fatalf("All() = %v %v, wants 1 migration", migrations, err)
+	}
+
+	m := migrations[0]
+
+	if m.InstalledBy != "deploy" || m.Hostname != "ci-1" || m.AppVersion != "2.3.0" || m.Rank != 7 {
+		t.Errorf("All() = %+v, wants the installation details", m)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+func Test_timeValue_Scan(t *testing.T) {
+	expected := time.Date(2016, 10, 1, 12, 30, 0, 123456000, time.UTC)
+	sources := []interface{}{
+		expected.In(time.FixedZone("BRT", -3*60*60)),
+		[]byte("2016-10-01 12:30:00.123456"),
+		"2016-10-01 09:30:00.123456-03:00",
+		"2016-10-01T12:30:00.123456Z",
+	}
+
+	for _, src := range sources {
+		var value timeValue
+
+		if err := value.Scan(src); err != nil || value.time != expected {
+			t.Errorf("Scan(%v) = %v %v, wants %v", src, value.time, err, expected)
+		}
+	}
+
+	var value timeValue
+
+	if err := value.Scan(int64(1475325000)); err == nil {
+		t.Error("Scan() must fail with integers")
+	}
+
+	if err := value.Scan("yesterday"); err == nil {
+		t.Error("Scan() must fail with invalid timestamps")
+	}
+}
+
+func Test_GenericDriver_All_scan_error(t *testing.T) {
+	connector := &faultyConnector{
+		rows: [][]driver.Value{
+			validRow("1"),
+			{"2", "Description", "checksum", time.Now(), "one second", true, "", false, "", "", "", int64(2)},
+		},
+	}
+
+	migrations, err := NewGenericDriver(sql.OpenDB(connector), PostgresDialect{}).All()
+
+	var scanError ScanError
+
+	if !errors.As(err, &scanError) || scanError.Row != 2 {
+		t.Errorf("All() error = %v, wants a ScanError of row 2", err)
+	}
+
+	if len(migrations) != 0 {
+		t.Errorf("All() = %v, wants no migrations", migrations)
+	}
+
+	if !connector.closed {
+		t.Error("The rows must be closed")
+	}
+}
+
+func Test_GenericDriver_All_applied_at_error(t *testing.T) {
+	connector := &faultyConnector{
+		rows: [][]driver.Value{
+			{"1", "Description", "checksum", int64(1475325000), int64(0), true, "", false, "", "", "", int64(1)},
+		},
+	}
+
+	_, err := NewGenericDriver(sql.OpenDB(connector), PostgresDialect{}).All()
+
+	var scanError ScanError
+
+	if !errors.As(err, &scanError) || scanError.Row != 1 {
+		t.Errorf("All() error = %v, wants a ScanError of row 1", err)
+	}
+}
+
+func Test_GenericDriver_All_iteration_error(t *testing.T) {
+	cause := errors.New("connection reset by peer")
+	connector := &faultyConnector{
+		rows: [][]driver.Value{validRow("1"), validRow("2")},
+		err:  cause,
+	}
+
+	migrations, err := NewGenericDriver(sql.OpenDB(connector), PostgresDialect{}).All()
+
+	var scanError ScanError
+
+	if !errors.As(err, &scanError) || scanError.Row != 3 || !errors.Is(err, cause) {
+		t.Errorf("All() error = %v, wants a ScanError of row 3", err)
+	}
+
+	if len(migrations) != 0 {
+		t.Errorf("All() = %v, wants no migrations", migrations)
+	}
+}
+
+func Test_ScanError(t *testing.T) {
+	cause := errors.New("bad connection")
+	err := ScanError{Row: 3, Err: cause}
+
+	if err.Error() != "Cannot read row 3 of the schema table: bad connection" {
+		t.Errorf("Unexpected error message %q", err.Error())
+	}
+
+	if !errors.Is(err, cause) {
+		t.Error("ScanError must unwrap to the database/sql error")
+	}
+}
+
+func Test_GenericDriver_All_error(t *testing.T) {
+	db, mock, err := sqlmock.New()
+
+	if err != nil {
+		t.Errorf("sqlmock.New().error != nil, wants nil")
+	}
+
+	defer db.Close()
+
+	dialect := MySQLDialect{}
+
+	d := NewGenericDriver(db, dialect)
+
+	mock.ExpectQuery(escapeQuery(dialect.AllSQL())).
+		WillReturnError(errors.New("Generic error"))
+
+	migrations, _ := d.All()
+
+	if len(migrations) != 0 {
+		t.Errorf("len(migrations) == %d, wants 0", len(migrations))
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+func Test_GenericDriver_All_failed(t *testing.T) {
+	db, mock, err := sqlmock.New()
+
+	if err != nil {
+		t.Errorf("sqlmock.New().error != nil, wants nil")
+	}
+
+	defer db.Close()
+
+	dialect := PostgresDialect{}
+
+	d := NewGenericDriver(db, dialect)
+
+	rows := sqlmock.NewRows([]string{
+		"version", "description", "checksum", "applied_at", "execution_time", "success", "error_message", "baseline",
+		"installed_by", "hostname", "app_version", "installed_rank",
+	}).AddRow(
+		1, "Description", "7ebca1c6f05333a728a8db4629e8d543",
+		time.Now(),
+		int64(time.Millisecond), false, "syntax error", false,
+		"postgres", "", "", 1,
+	)
+
+	mock.ExpectQuery(escapeQuery(dialect.AllSQL())).
+		WillReturnRows(rows)
+
+	migrations, _ := d.All()
+
+	if len(migrations) != 1 || !migrations[0].Failed || migrations[0].ErrorMessage != "syntax error" {
+		t.Errorf("migrations = %v, wants a failed migration", migrations)
+	}
+}
+
+func Test_GenericDriver_Delete(t *testing.T) {
+	db, mock, err := sqlmock.New()
+
+	if err != nil {
+		t.Errorf("sqlmock.New().error != nil, wants nil")
+	}
+
+	defer db.Close()
+
+	dialect := SqliteDialect{}
+
+	d := NewGenericDriver(db, dialect)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(escapeQuery(dialect.DeleteSQL())).
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := d.Delete(context.Background(), "1"); err != nil {
+		t.Errorf("Delete() error = %s, wants nil", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+func Test_GenericDriver_ExecDelete(t *testing.T) {
+	db, mock, err := sqlmock.New()
+
+	if err != nil {
+		t.Errorf("sqlmock.New().error != nil, wants nil")
+	}
+
+	defer db.Close()
+
+	stmt := "DROP TABLE HELLO"
+	dialect := PostgresDialect{}
+
+	d := NewGenericDriver(db, dialect)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(escapeQuery(stmt)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(escapeQuery(dialect.DeleteSQL())).
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := d.ExecDelete(context.Background(), stmt, "1"); err != nil {
+		t.Errorf("ExecDelete() error = %s, wants nil", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+func Test_GenericDriver_UpdateChecksum(t *testing.T) {
+	db, mock, err := sqlmock.New()
+
+	if err != nil {
+		t.Errorf("sqlmock.New().error != nil, wants nil")
+	}
+
+	defer db.Close()
+
+	dialect := MySQLDialect{}
+
+	d := NewGenericDriver(db, dialect)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(escapeQuery(dialect.UpdateChecksumSQL())).
+		WithArgs("7ebca1c6f05333a728a8db4629e8d543", "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := d.UpdateChecksum(context.Background(), "1", "7ebca1c6f05333a728a8db4629e8d543"); err != nil {
+		t.Errorf("UpdateChecksum() error = %s, wants nil", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+func Test_GenericDriver_Exec(t *testing.T) {
+	db, mock, err := sqlmock.New()
+
+	if err != nil {
+		t.Errorf("sqlmock.New().error != nil, wants nil")
+	}
+
+	defer db.Close()
+
+	stmt := "CREATE TABLE HELLO (id INT)"
+	dialect := MySQLDialect{}
+
+	d := NewGenericDriver(db, dialect)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(escapeQuery(stmt)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	d.Exec(stmt)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+func Test_GenericDriver_Exec_error(t *testing.T) {
+	db, mock, err := sqlmock.New()
+
+	if err != nil {
+		t.Errorf("sqlmock.New().error != nil, wants nil")
+	}
+
+	defer db.Close()
+
+	stmt := "CREATE TABLE HELLO (id INT)"
+	dialect := MySQLDialect{}
+
+	d := NewGenericDriver(db, dialect)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(escapeQuery(stmt)).
+		WillReturnError(errors.New("Generic Error"))
+	mock.ExpectRollback()
+
+	d.Exec(stmt)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+func Test_GenericDriver_Exec_statements(t *testing.T) {
+	db, mock, err := sqlmock.New()
+
+	if err != nil {
+		t.Errorf("sqlmock.New().error != nil, wants nil")
+	}
+
+	defer db.Close()
+
+	d := NewGenericDriver(db, MySQLDialect{})
+
 	mock.ExpectBegin()
-	mock.ExpectExec(escapeQuery(dialect.CreateTableSQL())).WillReturnResult(sqlmock.NewResult(0, 0))
-	mock.ExpectCommit()
+	mock.ExpectExec(escapeQuery("CREATE TABLE HELLO (id INT)")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(escapeQuery("INSERT INTO HELLO VALUES (1)")).
+		WillReturnError(errors.New("Generic Error"))
+	mock.ExpectRollback()
 
-	d := NewGenericDriver(db, dialect)
-	d.Create()
+	_, err = d.Exec("CREATE TABLE HELLO (id INT);\nINSERT INTO HELLO VALUES (1);\nSELECT 1;")
+
+	expected := StatementError{Index: 2, Statement: "INSERT INTO HELLO VALUES (1)", Err: errors.New("Generic Error")}
+
+	if e, ok := err.(StatementError); !ok || e.Index != expected.Index || e.Statement != expected.Statement {
+		t.Errorf("Exec() error = %v, wants %v", err, expected)
+	}
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expections: %s", err)
 	}
 }
 
-func Test_GenericDriver_Insert(t *testing.T) {
+func Test_GenericDriver_ExecNoTx(t *testing.T) {
 	db, mock, err := sqlmock.New()
 
 	if err != nil {
@@ -69,39 +654,110 @@ func Test_GenericDriver_Insert(t *testing.T) {
 
 	defer db.Close()
 
-	record := MigrationRecord{
-		Version:       1.0,
-		Description:   "Description",
-		Checksum:      "7ebca1c6f05333a728a8db4629e8d543",
-		AppliedAt:     time.Now(),
-		ExecutionTime: time.Millisecond * 1,
+	d := NewGenericDriver(db, PostgresDialect{})
+
+	mock.ExpectExec(escapeQuery("CREATE INDEX CONCURRENTLY idx ON posts (id)")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(escapeQuery("ALTER TYPE mood ADD VALUE 'happy'")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if _, err := d.ExecNoTx(context.Background(), "CREATE INDEX CONCURRENTLY idx ON posts (id);\nALTER TYPE mood ADD VALUE 'happy';"); err != nil {
+		t.Errorf("ExecNoTx() error = %s, wants nil", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+func Test_GenericDriver_ExecContext_canceled(t *testing.T) {
+	db, mock, err := sqlmock.New()
+
+	if err != nil {
+		t.Errorf("sqlmock.New().error != nil, wants nil")
 	}
 
+	defer db.Close()
+
+	stmt := "CREATE TABLE HELLO (id INT)"
 	dialect := MySQLDialect{}
 
 	d := NewGenericDriver(db, dialect)
 
+	ctx, cancel := context.WithCancel(context.Background())
+
+	mock.ExpectBegin().WillReturnError(context.Canceled)
+	cancel()
+
+	if _, err := d.ExecContext(ctx, stmt); err == nil {
+		t.Error("Must emit error")
+	}
+}
+
+func Test_retryLock_canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := retryLock(ctx, 0, func() (bool, error) {
+		return false, nil
+	})
+
+	if err != context.Canceled {
+		t.Errorf("retryLock() error = %v, wants context.Canceled", err)
+	}
+}
+
+func Test_GenericDriver_ExecInsert(t *testing.T) {
+	db, mock, err := sqlmock.New()
+
+	if err != nil {
+		t.Errorf("sqlmock.New().error != nil, wants nil")
+	}
+
+	defer db.Close()
+
+	stmt := "CREATE TABLE HELLO (id INT)"
+	record := MigrationRecord{
+		Version:     "1.0",
+		Description: "Description",
+		Checksum:    "7ebca1c6f05333a728a8db4629e8d543",
+		AppliedAt:   time.Now(),
+	}
+
+	dialect := PostgresDialect{}
+
+	d := NewGenericDriver(db, dialect)
+
 	mock.ExpectBegin()
+	mock.ExpectExec(escapeQuery(stmt)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectExec(escapeQuery(dialect.InsertSQL())).
 		WithArgs(
 			record.Version,
 			record.Description,
 			record.Checksum,
-			record.AppliedAt.Unix(),
-			record.ExecutionTime,
+			appliedAt(record.AppliedAt),
+			sqlmock.AnyArg(),
+			true,
+			"",
+			false,
+			"",
+			"",
+			"",
 		).
 		WillReturnResult(sqlmock.NewResult(1, 1))
-
 	mock.ExpectCommit()
 
-	d.Insert(record)
+	if err := d.ExecInsert(context.Background(), stmt, record); err != nil {
+		t.Errorf("ExecInsert() error = %s, wants nil", err)
+	}
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expections: %s", err)
 	}
 }
 
-func Test_GenericDriver_All_success(t *testing.T) {
+func Test_GenericDriver_ExecFuncInsert(t *testing.T) {
 	db, mock, err := sqlmock.New()
 
 	if err != nil {
@@ -110,25 +766,72 @@ func Test_GenericDriver_All_success(t *testing.T) {
 
 	defer db.Close()
 
-	dialect := MySQLDialect{}
+	record := MigrationRecord{
+		Version:     "1.0",
+		Description: "Description",
+		Checksum:    "v1",
+		AppliedAt:   time.Now(),
+	}
+
+	dialect := PostgresDialect{}
 
 	d := NewGenericDriver(db, dialect)
 
-	rows := sqlmock.NewRows([]string{
-		"version", "description", "checksum", "applied_at", "execution_time", "success",
-	}).AddRow(
-		1, "Description", "7ebca1c6f05333a728a8db4629e8d543",
-		time.Now().Unix(),
-		time.Millisecond*1, true,
-	)
+	mock.ExpectBegin()
+	mock.ExpectExec(escapeQuery("UPDATE posts SET title = $1")).
+		WithArgs("hello").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(escapeQuery(dialect.InsertSQL())).
+		WithArgs(
+			record.Version,
+			record.Description,
+			record.Checksum,
+			appliedAt(record.AppliedAt),
+			sqlmock.AnyArg(),
+			true,
+			"",
+			false,
+			"",
+			"",
+			"",
+		).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
 
-	mock.ExpectQuery(escapeQuery(dialect.AllSQL())).
-		WillReturnRows(rows)
+	f := func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "UPDATE posts SET title = $1", "hello")
+		return err
+	}
 
-	migrations, _ := d.All()
+	if err := d.ExecFuncInsert(context.Background(), f, record); err != nil {
+		t.Errorf("ExecFuncInsert() error = %s, wants nil", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+func Test_GenericDriver_ExecFuncInsert_error(t *testing.T) {
+	db, mock, err := sqlmock.New()
+
+	if err != nil {
+		t.Errorf("sqlmock.New().error != nil, wants nil")
+	}
+
+	defer db.Close()
+
+	d := NewGenericDriver(db, PostgresDialect{})
 
-	if len(migrations) != 1 {
-		t.Errorf("len(migrations) == %d, wants 1", len(migrations))
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	f := func(ctx context.Context, tx *sql.Tx) error {
+		return errors.New("backfill failed")
+	}
+
+	if err := d.ExecFuncInsert(context.Background(), f, MigrationRecord{}); err == nil {
+		t.Error("ExecFuncInsert() error = nil, wants the error of f")
 	}
 
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -136,7 +839,37 @@ func Test_GenericDriver_All_success(t *testing.T) {
 	}
 }
 
-func Test_GenericDriver_All_error(t *testing.T) {
+func Test_GenericDriver_ExecInsert_insert_error(t *testing.T) {
+	db, mock, err := sqlmock.New()
+
+	if err != nil {
+		t.Errorf("sqlmock.New().error != nil, wants nil")
+	}
+
+	defer db.Close()
+
+	stmt := "CREATE TABLE HELLO (id INT)"
+	dialect := PostgresDialect{}
+
+	d := NewGenericDriver(db, dialect)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(escapeQuery(stmt)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(escapeQuery(dialect.InsertSQL())).
+		WillReturnError(errors.New("Generic Error"))
+	mock.ExpectRollback()
+
+	if err := d.ExecInsert(context.Background(), stmt, MigrationRecord{}); err == nil {
+		t.Error("Must emit error")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+func Test_GenericDriver_Lock_advisory(t *testing.T) {
 	db, mock, err := sqlmock.New()
 
 	if err != nil {
@@ -149,13 +882,17 @@ func Test_GenericDriver_All_error(t *testing.T) {
 
 	d := NewGenericDriver(db, dialect)
 
-	mock.ExpectQuery(escapeQuery(dialect.AllSQL())).
-		WillReturnError(errors.New("Generic error"))
+	mock.ExpectQuery(escapeQuery(dialect.AdvisoryLockSQL())).
+		WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+	mock.ExpectExec(escapeQuery(dialect.AdvisoryUnlockSQL())).
+		WillReturnResult(sqlmock.NewResult(0, 0))
 
-	migrations, _ := d.All()
+	if err := d.Lock(context.Background(), time.Second); err != nil {
+		t.Errorf("Lock() error = %s, wants nil", err)
+	}
 
-	if len(migrations) != 0 {
-		t.Errorf("len(migrations) == %d, wants 0", len(migrations))
+	if err := d.Unlock(); err != nil {
+		t.Errorf("Unlock() error = %s, wants nil", err)
 	}
 
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -163,7 +900,7 @@ func Test_GenericDriver_All_error(t *testing.T) {
 	}
 }
 
-func Test_GenericDriver_Exec(t *testing.T) {
+func Test_GenericDriver_Lock_advisory_single_conn(t *testing.T) {
 	db, mock, err := sqlmock.New()
 
 	if err != nil {
@@ -172,24 +909,46 @@ func Test_GenericDriver_Exec(t *testing.T) {
 
 	defer db.Close()
 
-	stmt := "CREATE TABLE HELLO (id INT);"
+	db.SetMaxOpenConns(1)
+
 	dialect := MySQLDialect{}
 
 	d := NewGenericDriver(db, dialect)
 
+	mock.ExpectQuery(escapeQuery(dialect.AdvisoryLockSQL())).
+		WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
 	mock.ExpectBegin()
-	mock.ExpectExec(escapeQuery(stmt)).
-		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(escapeQuery(dialect.UpdateChecksumSQL())).
+		WithArgs("checksum", "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectCommit()
+	mock.ExpectExec(escapeQuery(dialect.AdvisoryUnlockSQL())).
+		WillReturnResult(sqlmock.NewResult(0, 0))
 
-	d.Exec(stmt)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := d.Lock(ctx, time.Second); err != nil {
+		t.Fatalf("Lock() error = %s, wants nil", err)
+	}
+
+	// Like the work done by Migrate holding the lock
+	ctx = context.WithValue(ctx, lockHeldKey{}, true)
+
+	if err := d.UpdateChecksum(ctx, Version("1"), "checksum"); err != nil {
+		t.Errorf("UpdateChecksum() error = %s, wants nil", err)
+	}
+
+	if err := d.Unlock(); err != nil {
+		t.Errorf("Unlock() error = %s, wants nil", err)
+	}
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expections: %s", err)
 	}
 }
 
-func Test_GenericDriver_Exec_error(t *testing.T) {
+func Test_GenericDriver_session(t *testing.T) {
 	db, mock, err := sqlmock.New()
 
 	if err != nil {
@@ -198,17 +957,105 @@ func Test_GenericDriver_Exec_error(t *testing.T) {
 
 	defer db.Close()
 
-	stmt := "CREATE TABLE HELLO (id INT);"
-	dialect := MySQLDialect{}
+	dialect := PostgresDialect{}
+
+	d := NewGenericDriver(db, dialect)
+
+	mock.ExpectQuery(escapeQuery(dialect.AdvisoryLockSQL())).
+		WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(true))
+	mock.ExpectExec(escapeQuery(dialect.AdvisoryUnlockSQL())).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := d.Lock(context.Background(), time.Second); err != nil {
+		t.Fatalf("Lock() error = %s, wants nil", err)
+	}
+
+	held := context.WithValue(context.Background(), lockHeldKey{}, true)
+
+	if d.session(held) == d.DB {
+		t.Error("The work holding the lock must run on its connection")
+	}
+
+	// Like Info called by another goroutine during Migrate
+	done := make(chan session)
+
+	go func() {
+		done <- d.session(context.Background())
+	}()
+
+	if s := <-done; s != d.DB {
+		t.Error("The work not holding the lock must run on DB")
+	}
+
+	if err := d.Unlock(); err != nil {
+		t.Errorf("Unlock() error = %s, wants nil", err)
+	}
+
+	if d.session(held) != d.DB {
+		t.Error("Must use DB after Unlock")
+	}
+}
+
+func Test_GenericDriver_Lock_advisory_timeout(t *testing.T) {
+	db, mock, err := sqlmock.New()
+
+	if err != nil {
+		t.Errorf("sqlmock.New().error != nil, wants nil")
+	}
+
+	defer db.Close()
+
+	lockRetryInterval = time.Millisecond
+	defer func() { lockRetryInterval = time.Second }()
+
+	dialect := PostgresDialect{}
+
+	d := NewGenericDriver(db, dialect)
+
+	mock.MatchExpectationsInOrder(false)
+
+	for i := 0; i < 100; i++ {
+		mock.ExpectQuery(escapeQuery(dialect.AdvisoryLockSQL())).
+			WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(false))
+	}
+
+	err = d.Lock(context.Background(), 10*time.Millisecond)
+
+	if _, ok := err.(LockTimeoutError); !ok {
+		t.Errorf("Lock() error = %v, wants LockTimeoutError", err)
+	}
+}
+
+func Test_GenericDriver_Lock_table(t *testing.T) {
+	db, mock, err := sqlmock.New()
+
+	if err != nil {
+		t.Errorf("sqlmock.New().error != nil, wants nil")
+	}
+
+	defer db.Close()
+
+	dialect := SqliteDialect{}
 
 	d := NewGenericDriver(db, dialect)
 
 	mock.ExpectBegin()
-	mock.ExpectExec(escapeQuery(stmt)).
-		WillReturnError(errors.New("Generic Error"))
-	mock.ExpectRollback()
+	mock.ExpectExec(escapeQuery(dialect.CreateLockTableSQL())).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(escapeQuery(dialect.InsertLockSQL())).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(escapeQuery(dialect.DeleteLockSQL())).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
 
-	d.Exec(stmt)
+	if err := d.Lock(context.Background(), time.Second); err != nil {
+		t.Errorf("Lock() error = %s, wants nil", err)
+	}
+
+	if err := d.Unlock(); err != nil {
+		t.Errorf("Unlock() error = %s, wants nil", err)
+	}
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expections: %s", err)
@@ -218,14 +1065,14 @@ func Test_GenericDriver_Exec_error(t *testing.T) {
 func Test_byMigrationRecordVersion(t *testing.T) {
 	unordered := []MigrationRecord{
 		{
-			Version:       1.1,
+			Version:       "1.1",
 			Description:   "Description",
 			Checksum:      "7ebca1c6f05333a728a8db4629e8d543",
 			AppliedAt:     time.Now(),
 			ExecutionTime: time.Millisecond * 1,
 		},
 		{
-			Version:       1.0,
+			Version:       "1.0",
 			Description:   "Description",
 			Checksum:      "7ebca1c6f05333a728a8db4629e8d543",
 			AppliedAt:     time.Now(),
@@ -235,7 +1082,7 @@ func Test_byMigrationRecordVersion(t *testing.T) {
 
 	sort.Sort(byMigrationRecordVersion(unordered))
 
-	if unordered[0].Version != 1.0 {
+	if unordered[0].Version != "1.0" {
 		t.Errorf("Must order by version number")
 	}
 }
@@ -325,3 +1172,84 @@ func escapeQuery(s string) string {
 	s1 = strings.TrimSpace(re.ReplaceAllString(s1, " "))
 	return s1
 }
+
+// validRow returns a row of AllSQL for the version
+func validRow(version string) []driver.Value {
+	return []driver.Value{version, "Description", "checksum", time.Now(), int64(time.Second), true, "", false, "", "", "", int64(1)}
+}
+
+// faultyConnector is a database/sql driver returning the rows of every query
+// and then err, it injects the faults sqlmock cannot, like a connection
+// dropped while reading the rows. Create the sql.DB with sql.OpenDB.
+type faultyConnector struct {
+	rows [][]driver.Value
+	err  error
+
+	// closed is true when the rows were closed
+	closed bool
+}
+
+func (f *faultyConnector) Connect(context.Context) (driver.Conn, error) {
+	return faultyConn{f}, nil
+}
+
+func (f *faultyConnector) Driver() driver.Driver {
+	return faultyDriver{}
+}
+
+type faultyDriver struct{}
+
+func (faultyDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("faulty driver: use sql.OpenDB")
+}
+
+type faultyConn struct {
+	connector *faultyConnector
+}
+
+func (c faultyConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("faulty driver: Prepare is not supported")
+}
+
+func (c faultyConn) Close() error {
+	return nil
+}
+
+func (c faultyConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("faulty driver: Begin is not supported")
+}
+
+func (c faultyConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return &faultyRows{connector: c.connector}, nil
+}
+
+type faultyRows struct {
+	connector *faultyConnector
+	next      int
+}
+
+func (r *faultyRows) Columns() []string {
+	return []string{
+		"version", "description", "checksum", "applied_at", "execution_time", "success", "error_message", "baseline",
+		"installed_by", "hostname", "app_version", "installed_rank",
+	}
+}
+
+func (r *faultyRows) Close() error {
+	r.connector.closed = true
+	return nil
+}
+
+func (r *faultyRows) Next(dest []driver.Value) error {
+	if r.next < len(r.connector.rows) {
+		copy(dest, r.connector.rows[r.next])
+		r.next++
+		return nil
+	}
+
+	if r.connector.err != nil {
+		return r.connector.err
+	}
+
+	return io.EOF
+}
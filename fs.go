@@ -0,0 +1,120 @@
+package darwin
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// migrationFileName matches Flyway-style names like V1.2__add_posts.sql and
+// R__posts_view.sql
+var migrationFileName = regexp.MustCompile(`^(?:V([0-9]+(?:[._][0-9]+)*)|R)__(.+)\.sql$`)
+
+// MalformedMigrationFileError is used to report a migration file with an invalid name
+type MalformedMigrationFileError struct {
+	Path string
+}
+
+func (m MalformedMigrationFileError) Error() string {
+	return fmt.Sprintf("Malformed migration file name %s, expected V<version>__<description>.sql", m.Path)
+}
+
+// DuplicateMigrationFileError is used to report when two migration files have
+// the same version, or the same description when they are repeatable
+type DuplicateMigrationFileError struct {
+	Version       Version
+	Path          string
+	DuplicatePath string
+}
+
+func (d DuplicateMigrationFileError) Error() string {
+	if d.Version == "" {
+		return fmt.Sprintf("Repeatable migration files %s and %s have the same description.", d.Path, d.DuplicatePath)
+	}
+
+	return fmt.Sprintf("Migration files %s and %s have the version number %s.", d.Path, d.DuplicatePath, d.Version)
+}
+
+// FromFS reads the migrations from the .sql files in dir, sorted by version.
+// Files must be named V<version>__<description>.sql, like V1.2__add_posts.sql,
+// underscores in the version are read as dots and in the description as spaces.
+// Repeatable migrations are named R__<description>.sql, like R__posts_view.sql.
+// Subdirectories and files with other extensions are ignored.
+func FromFS(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+
+	if err != nil {
+		return []Migration{}, err
+	}
+
+	migrations := []Migration{}
+	paths := map[string]string{}
+
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+
+		filePath := path.Join(dir, entry.Name())
+		migration, err := parseMigrationFileName(entry.Name())
+
+		if err != nil {
+			return []Migration{}, MalformedMigrationFileError{Path: filePath}
+		}
+
+		key := "V" + string(migration.Version.canonical())
+
+		if migration.Repeatable {
+			key = "R" + migration.Description
+		}
+
+		if other, exists := paths[key]; exists {
+			return []Migration{}, DuplicateMigrationFileError{
+				Version:       migration.Version,
+				Path:          other,
+				DuplicatePath: filePath,
+			}
+		}
+
+		script, err := fs.ReadFile(fsys, filePath)
+
+		if err != nil {
+			return []Migration{}, err
+		}
+
+		paths[key] = filePath
+		migration.Script = string(script)
+		migrations = append(migrations, migration)
+	}
+
+	sort.Sort(byMigrationVersion(migrations))
+
+	return migrations, nil
+}
+
+// parseMigrationFileName returns the migration named name, without Script
+func parseMigrationFileName(name string) (Migration, error) {
+	matches := migrationFileName.FindStringSubmatch(name)
+
+	if matches == nil {
+		return Migration{}, fmt.Errorf("invalid migration file name %s", name)
+	}
+
+	repeatable := strings.HasPrefix(name, "R")
+	version := Version(strings.Replace(matches[1], "_", ".", -1))
+
+	if !repeatable && !version.Valid() {
+		return Migration{}, fmt.Errorf("invalid version in %s", name)
+	}
+
+	description := strings.TrimSpace(strings.Replace(matches[2], "_", " ", -1))
+
+	if description == "" {
+		return Migration{}, fmt.Errorf("missing description in %s", name)
+	}
+
+	return Migration{Version: version, Description: description, Repeatable: repeatable}, nil
+}
@@ -0,0 +1,117 @@
+package darwin
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func Test_FromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/V2__Adding_column_body.sql":    {Data: []byte("ALTER TABLE posts ADD body TEXT;")},
+		"migrations/V1_1__create_posts.sql":        {Data: []byte("CREATE TABLE posts (id INT);")},
+		"migrations/V1__create_users.sql":          {Data: []byte("CREATE TABLE users (id INT);")},
+		"migrations/V1.10.2__add_index.sql":        {Data: []byte("CREATE INDEX idx ON posts (id);")},
+		"migrations/R__posts_view.sql":             {Data: []byte("CREATE OR REPLACE VIEW v AS SELECT 1;")},
+		"migrations/README.md":                     {Data: []byte("not a migration")},
+		"migrations/old/V3__ignored_directory.sql": {Data: []byte("SELECT 1;")},
+	}
+
+	migrations, err := FromFS(fsys, "migrations")
+
+	if err != nil {
+		t.Fatalf("FromFS() error = %s, wants nil", err)
+	}
+
+	expectations := []Migration{
+		{Description: "posts view", Script: "CREATE OR REPLACE VIEW v AS SELECT 1;", Repeatable: true},
+		{Version: "1", Description: "create users", Script: "CREATE TABLE users (id INT);"},
+		{Version: "1.1", Description: "create posts", Script: "CREATE TABLE posts (id INT);"},
+		{Version: "1.10.2", Description: "add index", Script: "CREATE INDEX idx ON posts (id);"},
+		{Version: "2", Description: "Adding column body", Script: "ALTER TABLE posts ADD body TEXT;"},
+	}
+
+	if len(migrations) != len(expectations) {
+		t.Fatalf("len(migrations) == %d, wants %d", len(migrations), len(expectations))
+	}
+
+	for i, expected := range expectations {
+		if !reflect.DeepEqual(migrations[i], expected) {
+			t.Errorf("migrations[%d] == %+v, wants %+v", i, migrations[i], expected)
+		}
+	}
+}
+
+func Test_FromFS_malformed_name(t *testing.T) {
+	names := []string{
+		"create_posts.sql",
+		"V1_create_posts.sql",
+		"V__create_posts.sql",
+		"V1__.sql",
+		"V1.2.a__create_posts.sql",
+		"R1__posts_view.sql",
+		"R__.sql",
+	}
+
+	for _, name := range names {
+		fsys := fstest.MapFS{
+			"migrations/" + name: {Data: []byte("SELECT 1;")},
+		}
+
+		_, err := FromFS(fsys, "migrations")
+
+		if err != (MalformedMigrationFileError{Path: "migrations/" + name}) {
+			t.Errorf("FromFS() error = %v, wants MalformedMigrationFileError for %s", err, name)
+		}
+	}
+}
+
+func Test_FromFS_duplicated_version(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/V1__create_posts.sql":   {Data: []byte("SELECT 1;")},
+		"migrations/V1.0__create_users.sql": {Data: []byte("SELECT 1;")},
+	}
+
+	_, err := FromFS(fsys, "migrations")
+
+	expected := DuplicateMigrationFileError{
+		Version:       "1",
+		Path:          "migrations/V1.0__create_users.sql",
+		DuplicatePath: "migrations/V1__create_posts.sql",
+	}
+
+	if err != expected {
+		t.Errorf("FromFS() error = %v, wants %v", err, expected)
+	}
+}
+
+func Test_FromFS_duplicated_repeatable(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/R__posts_view.sql":  {Data: []byte("SELECT 1;")},
+		"migrations/R__posts view.sql":  {Data: []byte("SELECT 1;")},
+		"migrations/V1__posts_view.sql": {Data: []byte("SELECT 1;")},
+	}
+
+	_, err := FromFS(fsys, "migrations")
+
+	expected := DuplicateMigrationFileError{
+		Path:          "migrations/R__posts view.sql",
+		DuplicatePath: "migrations/R__posts_view.sql",
+	}
+
+	if err != expected {
+		t.Errorf("FromFS() error = %v, wants %v", err, expected)
+	}
+
+	if err.Error() != "Repeatable migration files migrations/R__posts view.sql and migrations/R__posts_view.sql have the same description." {
+		t.Errorf("Unexpected error message %q", err.Error())
+	}
+}
+
+func Test_FromFS_missing_dir(t *testing.T) {
+	_, err := FromFS(fstest.MapFS{}, "migrations")
+
+	if err == nil {
+		t.Error("Must emit error")
+	}
+}
@@ -1,45 +1,253 @@
 package darwin
 
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
 // MySQLDialect a Dialect configured for MySQL
-type MySQLDialect struct{}
+type MySQLDialect struct {
+	// TableName is the name of the schema table, DefaultTableName if empty
+	TableName string
+
+	// Schema is the database of the schema table, the current database if empty
+	Schema string
+}
 
 // CreateTableSQL returns the SQL to create the schema table
 func (m MySQLDialect) CreateTableSQL() string {
-	return `CREATE TABLE IF NOT EXISTS darwin_migrations
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
                 (
                     id             INT          auto_increment,
-                    version        FLOAT        NOT NULL,
+                    version        VARCHAR(255) NOT NULL,
                     description    VARCHAR(255) NOT NULL,
-                    checksum       VARCHAR(32)  NOT NULL,
-                    applied_at     INT          NOT NULL,
-                    execution_time FLOAT        NOT NULL,
-                    UNIQUE         (version),
+                    checksum       VARCHAR(64)  NOT NULL,
+                    applied_at     DATETIME(6)  NOT NULL,
+                    execution_time BIGINT       NOT NULL,
+                    success        BOOLEAN      NOT NULL,
+                    error_message  TEXT         NOT NULL,
+                    baseline       BOOLEAN      NOT NULL,
+                    installed_by   VARCHAR(255) NOT NULL,
+                    hostname       VARCHAR(255) NOT NULL,
+                    app_version    VARCHAR(255) NOT NULL,
+                    installed_rank INT          NOT NULL,
                     PRIMARY KEY    (id)
-                ) ENGINE=InnoDB CHARACTER SET=utf8;`
+                ) ENGINE=InnoDB CHARACTER SET=utf8;`, m.table())
 }
 
-// InsertSQL returns the SQL to insert a new migration in the schema table
+// InsertSQL returns the SQL to insert a new migration in the schema table,
+// the rank follows the last one and installed_by defaults to the current user.
+// MySQL does not allow a subquery of the same table in VALUES.
 func (m MySQLDialect) InsertSQL() string {
-	return `INSERT INTO darwin_migrations
+	return fmt.Sprintf(`INSERT INTO %[1]s
                 (
                     version,
                     description,
                     checksum,
                     applied_at,
-                    execution_time
+                    execution_time,
+                    success,
+                    error_message,
+                    baseline,
+                    installed_by,
+                    hostname,
+                    app_version,
+                    installed_rank
                 )
-            VALUES (?, ?, ?, ?, ?);`
+            SELECT ?, ?, ?, ?, ?, ?, ?, ?, COALESCE(NULLIF(?, ''), CURRENT_USER()), ?, ?,
+                COALESCE(MAX(installed_rank), 0) + 1
+            FROM %[1]s;`, m.table())
 }
 
 // AllSQL returns a SQL to get all entries in the table
 func (m MySQLDialect) AllSQL() string {
-	return `SELECT 
+	return fmt.Sprintf(`SELECT 
                 version,
                 description,
                 checksum,
                 applied_at,
-                execution_time
+                execution_time,
+                success,
+                error_message,
+                baseline,
+                installed_by,
+                hostname,
+                app_version,
+                installed_rank
             FROM 
-                darwin_migrations
-            ORDER BY version ASC;`
+                %s
+            ORDER BY version ASC, id ASC;`, m.table())
+}
+
+// DeleteSQL returns the SQL to remove the entry of a version from the schema table
+func (m MySQLDialect) DeleteSQL() string {
+	return fmt.Sprintf(`DELETE FROM %s WHERE version = ?;`, m.table())
+}
+
+// UpdateChecksumSQL returns the SQL to replace the checksum of a version
+func (m MySQLDialect) UpdateChecksumSQL() string {
+	return fmt.Sprintf(`UPDATE %s SET checksum = ? WHERE version = ?;`, m.table())
+}
+
+// AdvisoryLockSQL returns the SQL to try to acquire the migration lock
+func (m MySQLDialect) AdvisoryLockSQL() string {
+	return fmt.Sprintf("SELECT GET_LOCK('%s', 0);", m.lockName())
+}
+
+// AdvisoryUnlockSQL returns the SQL to release the migration lock
+func (m MySQLDialect) AdvisoryUnlockSQL() string {
+	return fmt.Sprintf("SELECT RELEASE_LOCK('%s');", m.lockName())
+}
+
+// CreateSchemaVersionTableSQL returns the SQL to create the schema version table
+func (m MySQLDialect) CreateSchemaVersionTableSQL() string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                (
+                    version INT NOT NULL
+                ) ENGINE=InnoDB;`, m.schemaVersionTable())
+}
+
+// SchemaVersionSQL returns a query for the version of the schema table
+func (m MySQLDialect) SchemaVersionSQL() string {
+	return fmt.Sprintf(`SELECT MAX(version) FROM %s;`, m.schemaVersionTable())
+}
+
+// InsertSchemaVersionSQL returns the SQL to store a new version of the schema table
+func (m MySQLDialect) InsertSchemaVersionSQL() string {
+	return fmt.Sprintf(`INSERT INTO %s (version) VALUES (?);`, m.schemaVersionTable())
+}
+
+// ColumnsSQL returns a query for the names of the columns of the schema table
+func (m MySQLDialect) ColumnsSQL() string {
+	return fmt.Sprintf(`SELECT column_name
+            FROM information_schema.columns
+            WHERE %s;`, m.columnsCondition())
+}
+
+// UpgradeSQL returns the script upgrading the schema table from version.
+// MySQL commits each ALTER TABLE, so a step that fails halfway is not rolled
+// back: each statement runs only when the columns show it is still to be
+// done, and the step can run again.
+func (m MySQLDialect) UpgradeSQL(version int) string {
+	switch version {
+	case 1:
+		return m.unless("column_name = 'success'", fmt.Sprintf(`ALTER TABLE %s
+                DROP INDEX version,
+                MODIFY version       VARCHAR(255) NOT NULL,
+                MODIFY checksum      VARCHAR(64)  NOT NULL,
+                ADD    success       BOOLEAN      NOT NULL DEFAULT TRUE,
+                ADD    error_message TEXT         NOT NULL,
+                ADD    baseline      BOOLEAN      NOT NULL DEFAULT FALSE`, m.table()))
+	case 2:
+		// The seconds are added to the epoch, FROM_UNIXTIME would use the
+		// session time zone
+		return m.unless("column_name = 'applied_at_utc' OR column_name = 'applied_at' AND data_type = 'datetime'", fmt.Sprintf(`ALTER TABLE %s
+                ADD    applied_at_utc DATETIME(6) NULL AFTER applied_at,
+                MODIFY execution_time BIGINT      NOT NULL`, m.table())) +
+			m.when("column_name = 'applied_at_utc'", fmt.Sprintf(`UPDATE %s
+                SET applied_at_utc = DATE_ADD('1970-01-01 00:00:00', INTERVAL applied_at SECOND)`, m.table())) +
+			m.when("column_name = 'applied_at_utc'", fmt.Sprintf(`ALTER TABLE %s
+                DROP   applied_at,
+                CHANGE applied_at_utc applied_at DATETIME(6) NOT NULL`, m.table()))
+	case 3:
+		// The ranks are counted in a derived table, MySQL does not allow a
+		// subquery of the updated table
+		return m.unless("column_name = 'installed_rank'", fmt.Sprintf(`ALTER TABLE %s
+                ADD installed_by   VARCHAR(255) NOT NULL DEFAULT '',
+                ADD hostname       VARCHAR(255) NOT NULL DEFAULT '',
+                ADD app_version    VARCHAR(255) NOT NULL DEFAULT '',
+                ADD installed_rank INT          NULL`, m.table())) +
+			fmt.Sprintf(`
+            UPDATE %[1]s AS m
+                JOIN (SELECT a.id, COUNT(*) AS installed_rank
+                    FROM %[1]s AS a JOIN %[1]s AS b ON b.id <= a.id
+                    GROUP BY a.id) AS r ON m.id = r.id
+                SET m.installed_rank = r.installed_rank;
+            ALTER TABLE %[1]s MODIFY installed_rank INT NOT NULL;`, m.table())
+	default:
+		return ""
+	}
+}
+
+// when returns the statements executing stmt only if a column of the schema
+// table matches condition
+func (m MySQLDialect) when(condition, stmt string) string {
+	return m.guard("> 0", condition, stmt)
+}
+
+// unless returns the statements executing stmt only if no column of the
+// schema table matches condition
+func (m MySQLDialect) unless(condition, stmt string) string {
+	return m.guard("= 0", condition, stmt)
+}
+
+// guard returns the statements executing stmt if the count of the columns
+// matching condition passes the comparison, MySQL has no conditional DDL
+// outside stored programs but it can prepare a statement from a variable
+func (m MySQLDialect) guard(comparison, condition, stmt string) string {
+	return fmt.Sprintf(`
+            SET @darwin_upgrade = IF((SELECT COUNT(*) FROM information_schema.columns
+                WHERE %s AND (%s)) %s, %s, 'DO 0');
+            PREPARE darwin_upgrade FROM @darwin_upgrade;
+            EXECUTE darwin_upgrade;
+            DEALLOCATE PREPARE darwin_upgrade;`, m.columnsCondition(), condition, comparison, m.literal(stmt))
+}
+
+// columnsCondition returns the condition selecting the columns of the schema
+// table in information_schema.columns
+func (m MySQLDialect) columnsCondition() string {
+	schema := "DATABASE()"
+
+	if m.Schema != "" {
+		schema = sqlLiteral(m.Schema)
+	}
+
+	return fmt.Sprintf("table_schema = %s AND table_name = %s", schema, sqlLiteral(tableName(m.TableName)))
+}
+
+// SplitStatements splits script in statements, it understands the DELIMITER
+// command of the mysql client
+func (m MySQLDialect) SplitStatements(script string) []string {
+	return splitStatements(script, splitOptions{
+		backslashEscapes: true,
+		backticks:        true,
+		dashComments:     true,
+		dashSpace:        true,
+		hashComments:     true,
+		delimiterCommand: true,
+	})
+}
+
+// literal formats v as a MySQL literal, backslashes are escapes in strings
+// and DATETIME takes no time zone
+func (m MySQLDialect) literal(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return "'" + strings.NewReplacer(`\`, `\\`, "'", "''").Replace(v) + "'"
+	case time.Time:
+		return "'" + v.UTC().Format("2006-01-02 15:04:05.999999") + "'"
+	default:
+		return sqlLiteral(v)
+	}
+}
+
+// comment formats text as a SQL comment
+func (m MySQLDialect) comment(text string) string {
+	return sqlComment(text)
+}
+
+// table returns the quoted name of the schema table
+func (m MySQLDialect) table() string {
+	return qualifiedName(m.Schema, tableName(m.TableName), "`")
+}
+
+// schemaVersionTable returns the quoted name of the schema version table
+func (m MySQLDialect) schemaVersionTable() string {
+	return qualifiedName(m.Schema, tableName(m.TableName)+"_schema_version", "`")
+}
+
+// lockName returns a name for GET_LOCK shorter than its 64 characters limit
+func (m MySQLDialect) lockName() string {
+	return fmt.Sprintf("darwin_%x", uint64(advisoryLockKey(m.table())))
 }
@@ -0,0 +1,264 @@
+package darwin
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MigrationPlan describes what Migrate would do
+type MigrationPlan struct {
+	// Migrations are the migrations to be applied, in order
+	Migrations []Migration
+
+	// ValidationError is the result of Validate, Migrate refuses to apply
+	// the migrations when it is not nil
+	ValidationError error
+
+	// records are the entries to be inserted for each migration
+	records []MigrationRecord
+}
+
+// FuncMigrationScriptError is used to report a Go migration in a plan rendered as SQL
+type FuncMigrationScriptError struct {
+	Version Version
+}
+
+func (f FuncMigrationScriptError) Error() string {
+	return fmt.Sprintf("Migration %s is written in Go and cannot be rendered as SQL", f.Version)
+}
+
+// schemaInspector is implemented by drivers able to tell the version of the
+// schema table without changing the database, see Plan
+type schemaInspector interface {
+	// inspectSchemaVersion returns the version of the schema table, 0 if it
+	// does not exist, or false if it cannot tell
+	inspectSchemaVersion(ctx context.Context) (int, bool, error)
+}
+
+// Plan returns the migrations that Migrate would apply, without applying them.
+//
+// The database is not changed when the driver is a GenericDriver with an
+// UpgradeDialect, like the dialects of this package: a missing schema table
+// has no migrations applied and an older one is reported with an
+// OutdatedSchemaError, Migrate upgrades it. Other drivers cannot tell whether
+// the schema table exists, so Plan creates it with them.
+func (d Darwin) Plan() (MigrationPlan, error) {
+	return d.PlanContext(context.Background())
+}
+
+// PlanContext is like Plan, but it stops when ctx is done
+func (d Darwin) PlanContext(ctx context.Context) (MigrationPlan, error) {
+	plan := MigrationPlan{Migrations: []Migration{}}
+
+	records, err := d.planRecords(ctx)
+
+	if err != nil {
+		return plan, err
+	}
+
+	planned := plannedMigrations(records, d.migrations, d.OutOfOrder, d.validChecksum)
+	plan.ValidationError = d.validationReport(records).Err()
+
+	for _, migration := range upToTarget(planned, d.Target) {
+		plan.Migrations = append(plan.Migrations, migration)
+		plan.records = append(plan.records, d.newRecord(migration))
+	}
+
+	return plan, nil
+}
+
+// planRecords returns the entries of the schema table, see Plan
+func (d Darwin) planRecords(ctx context.Context) ([]MigrationRecord, error) {
+	return d.inspectedRecords(ctx, d.createdRecords)
+}
+
+// appliedRecords returns the entries of the schema table, none when it does
+// not exist yet. Like Plan, it does not change the database.
+func (d Darwin) appliedRecords(ctx context.Context) ([]MigrationRecord, error) {
+	return d.inspectedRecords(ctx, func(ctx context.Context) ([]MigrationRecord, error) {
+		return allContext(ctx, d.driver)
+	})
+}
+
+// inspectedRecords returns the entries of the schema table when the driver
+// can tell its version, otherwise the ones returned by fallback
+func (d Darwin) inspectedRecords(ctx context.Context, fallback func(context.Context) ([]MigrationRecord, error)) ([]MigrationRecord, error) {
+	inspector, ok := d.driver.(schemaInspector)
+
+	if !ok {
+		return fallback(ctx)
+	}
+
+	version, ok, err := inspector.inspectSchemaVersion(ctx)
+
+	switch {
+	case err != nil:
+		return []MigrationRecord{}, err
+	case !ok:
+		return fallback(ctx)
+	case version == 0:
+		return []MigrationRecord{}, nil
+	case version < SchemaVersion:
+		return []MigrationRecord{}, OutdatedSchemaError{Version: version}
+	case version > SchemaVersion:
+		return []MigrationRecord{}, SchemaVersionError{Version: version}
+	}
+
+	return allContext(ctx, d.driver)
+}
+
+// createdRecords creates the schema table if necessary and returns its entries
+func (d Darwin) createdRecords(ctx context.Context) ([]MigrationRecord, error) {
+	if err := createContext(ctx, d.driver); err != nil {
+		return []MigrationRecord{}, err
+	}
+
+	return allContext(ctx, d.driver)
+}
+
+// Script renders the plan as a single SQL script for dialect, so it can be
+// reviewed and applied by hand. Each migration script is followed by the
+// insert of its entry in the schema table. Invalid plans and plans with Go
+// migrations are not rendered.
+func (p MigrationPlan) Script(dialect Dialect) (string, error) {
+	if p.ValidationError != nil {
+		return "", p.ValidationError
+	}
+
+	var b strings.Builder
+
+	literal, comment := sqlLiteral, sqlComment
+
+	if renderer, ok := dialect.(renderDialect); ok {
+		literal, comment = renderer.literal, renderer.comment
+	}
+
+	b.WriteString(terminate(dialect.CreateTableSQL()))
+
+	// The version is stored, so Create does not upgrade the table
+	if upgrader, ok := dialect.(UpgradeDialect); ok {
+		b.WriteString("\n")
+		b.WriteString(terminate(upgrader.CreateSchemaVersionTableSQL()))
+		b.WriteString("\n")
+		b.WriteString(terminate(bindLiterals(literal, upgrader.InsertSchemaVersionSQL(), int64(SchemaVersion))))
+	}
+
+	for i, migration := range p.Migrations {
+		if migration.Func != nil {
+			return "", FuncMigrationScriptError{Version: migration.Version}
+		}
+
+		record := MigrationRecord{
+			Version:     migration.Version,
+			Description: migration.Description,
+			Checksum:    migration.Checksum(),
+			AppliedAt:   appliedAt(time.Now()),
+			Hostname:    hostname(),
+		}
+
+		if i < len(p.records) {
+			record = p.records[i]
+		}
+
+		if migration.Repeatable {
+			fmt.Fprintf(&b, "\n\n%s\n", comment("Repeatable migration: "+migration.Description))
+		} else {
+			fmt.Fprintf(&b, "\n\n%s\n", comment(fmt.Sprintf("Migration %s: %s", migration.Version, migration.Description)))
+		}
+
+		b.WriteString(terminate(migration.Script))
+		b.WriteString("\n")
+		b.WriteString(terminate(bindLiterals(literal, dialect.InsertSQL(), insertArgs(record)...)))
+	}
+
+	b.WriteString("\n")
+
+	return b.String(), nil
+}
+
+// terminate trims the statement and makes sure it ends with a semicolon
+func terminate(stmt string) string {
+	stmt = strings.TrimSpace(stmt)
+
+	if !strings.HasSuffix(stmt, ";") {
+		stmt += ";"
+	}
+
+	return stmt
+}
+
+// renderDialect is implemented by dialects whose literals and comments are
+// not the standard SQL ones, see MigrationPlan.Script
+type renderDialect interface {
+	// literal formats v as a literal of the dialect
+	literal(v interface{}) string
+
+	// comment formats text as a single line comment
+	comment(text string) string
+}
+
+// bindLiterals replaces the ? and $N placeholders in query by args formatted
+// by literal
+func bindLiterals(literal func(interface{}) string, query string, args ...interface{}) string {
+	var b strings.Builder
+	next := 0
+
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+
+		switch c {
+		case '?':
+			if next < len(args) {
+				b.WriteString(literal(args[next]))
+				next++
+				continue
+			}
+		case '$':
+			j := i + 1
+
+			for j < len(query) && query[j] >= '0' && query[j] <= '9' {
+				j++
+			}
+
+			if n, err := strconv.Atoi(query[i+1 : j]); err == nil && n >= 1 && n <= len(args) {
+				b.WriteString(literal(args[n-1]))
+				i = j - 1
+				continue
+			}
+		}
+
+		b.WriteByte(c)
+	}
+
+	return b.String()
+}
+
+// sqlLiteral formats v as a SQL literal
+func sqlLiteral(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return "'" + strings.Replace(v, "'", "''", -1) + "'"
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case time.Duration:
+		return strconv.FormatInt(int64(v), 10)
+	case time.Time:
+		return "'" + v.UTC().Format("2006-01-02 15:04:05.999999-07:00") + "'"
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// sqlComment formats text as a SQL comment, new lines are replaced
+func sqlComment(text string) string {
+	return "-- " + strings.Replace(text, "\n", " ", -1)
+}
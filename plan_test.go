@@ -0,0 +1,209 @@
+package darwin
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Darwin_Plan(t *testing.T) {
+	records := []MigrationRecord{
+		{
+			Version:  "1",
+			Checksum: "3310d0ff858faac79e854454c9e403da",
+		},
+	}
+
+	migrations := []Migration{
+		{Version: "1", Description: "First Migration", Script: "does not matter!"},
+		{Version: "3", Description: "Third Migration", Script: "does not matter!"},
+		{Version: "2", Description: "Second Migration", Script: "does not matter!"},
+	}
+
+	driver := &dummyDriver{records: records}
+
+	plan, err := New(driver, migrations, nil).Plan()
+
+	if err != nil {
+		t.Fatalf("Plan() error = %s, wants nil", err)
+	}
+
+	if plan.ValidationError != nil {
+		t.Errorf("plan.ValidationError = %s, wants nil", plan.ValidationError)
+	}
+
+	if len(plan.Migrations) != 2 || plan.Migrations[0].Version != "2" || plan.Migrations[1].Version != "3" {
+		t.Errorf("plan.Migrations = %v, wants versions 2 and 3", plan.Migrations)
+	}
+
+	if len(driver.records) != 1 {
+		t.Error("Must not apply the planned migrations")
+	}
+}
+
+func Test_Darwin_Plan_target(t *testing.T) {
+	migrations := []Migration{
+		{Version: "1", Description: "First Migration", Script: "does not matter!"},
+		{Version: "2", Description: "Second Migration", Script: "does not matter!"},
+	}
+
+	d := New(&dummyDriver{}, migrations, nil)
+	d.Target = "1"
+
+	plan, err := d.Plan()
+
+	if err != nil {
+		t.Fatalf("Plan() error = %s, wants nil", err)
+	}
+
+	if len(plan.Migrations) != 1 || plan.Migrations[0].Version != "1" {
+		t.Errorf("plan.Migrations = %v, wants version 1", plan.Migrations)
+	}
+}
+
+func Test_Darwin_Plan_invalid(t *testing.T) {
+	records := []MigrationRecord{
+		{
+			Version:  "1",
+			Checksum: "invalid",
+		},
+	}
+
+	migrations := []Migration{
+		{Version: "1", Description: "First Migration", Script: "does not matter!"},
+	}
+
+	plan, err := New(&dummyDriver{records: records}, migrations, nil).Plan()
+
+	if err != nil {
+		t.Fatalf("Plan() error = %s, wants nil", err)
+	}
+
+	expected := InvalidChecksumError{Version: "1", Stored: "invalid", Computed: "3310d0ff858faac79e854454c9e403da"}
+
+	if plan.ValidationError != expected {
+		t.Errorf("plan.ValidationError = %v, wants InvalidChecksumError", plan.ValidationError)
+	}
+
+	if _, err := plan.Script(MySQLDialect{}); err == nil {
+		t.Error("Must not render an invalid plan")
+	}
+}
+
+func Test_Darwin_Plan_error(t *testing.T) {
+	_, err := New(&dummyDriver{AllError: true}, []Migration{}, nil).Plan()
+
+	if err == nil {
+		t.Error("Must emit error")
+	}
+}
+
+func Test_MigrationPlan_Script(t *testing.T) {
+	plan := MigrationPlan{
+		Migrations: []Migration{
+			{Version: "1.5", Description: "Creating table posts", Script: "CREATE TABLE posts (id INT)"},
+			{Description: "Posts view", Script: "CREATE VIEW posts_view AS SELECT 1", Repeatable: true},
+		},
+		records: []MigrationRecord{
+			{
+				Version:       "1.5",
+				Description:   "Bobby's table",
+				Checksum:      "7ebca1c6f05333a728a8db4629e8d543",
+				AppliedAt:     time.Unix(1000, 0),
+				ExecutionTime: 0,
+				InstalledBy:   "deploy",
+				Hostname:      "ci-1",
+				AppVersion:    "2.3.0",
+			},
+		},
+	}
+
+	script, err := plan.Script(PostgresDialect{})
+
+	if err != nil {
+		t.Fatalf("Script() error = %s, wants nil", err)
+	}
+
+	expectations := []string{
+		`CREATE TABLE IF NOT EXISTS "darwin_migrations"`,
+		fmt.Sprintf(`INSERT INTO "darwin_migrations_schema_version" (version) VALUES (%d);`, SchemaVersion),
+		"-- Migration 1.5: Creating table posts\nCREATE TABLE posts (id INT);\n",
+		"VALUES ('1.5', 'Bobby''s table', '7ebca1c6f05333a728a8db4629e8d543', '1970-01-01 00:16:40+00:00', 0, true, '', false, " +
+			"COALESCE(NULLIF('deploy', ''), current_user), 'ci-1', '2.3.0',",
+		"-- Repeatable migration: Posts view\nCREATE VIEW posts_view AS SELECT 1;\n",
+		"VALUES ('', 'Posts view', ",
+	}
+
+	for _, expected := range expectations {
+		if !strings.Contains(script, expected) {
+			t.Errorf("Script() = %s, wants it to contain %s", script, expected)
+		}
+	}
+}
+
+func Test_MigrationPlan_Script_mysql(t *testing.T) {
+	plan := MigrationPlan{
+		Migrations: []Migration{
+			{Version: "1", Description: `Importing C:\new`, Script: "CREATE TABLE posts (id INT)"},
+		},
+		records: []MigrationRecord{
+			{
+				Version:     "1",
+				Description: `Importing C:\new`,
+				Checksum:    "checksum",
+				AppliedAt:   time.Unix(1000, 500000000),
+			},
+		},
+	}
+
+	script, err := plan.Script(MySQLDialect{})
+
+	if err != nil {
+		t.Fatalf("Script() error = %s, wants nil", err)
+	}
+
+	expected := `SELECT '1', 'Importing C:\\new', 'checksum', '1970-01-01 00:16:40.5', 0,`
+
+	if !strings.Contains(script, expected) {
+		t.Errorf("Script() = %s, wants it to contain %s", script, expected)
+	}
+}
+
+func Test_MigrationPlan_Script_func(t *testing.T) {
+	plan := MigrationPlan{
+		Migrations: []Migration{
+			{
+				Version:      "1",
+				Description:  "Backfill",
+				Func:         func(ctx context.Context, tx *sql.Tx) error { return nil },
+				FuncChecksum: "v1",
+			},
+		},
+	}
+
+	if _, err := plan.Script(PostgresDialect{}); err != (FuncMigrationScriptError{Version: "1"}) {
+		t.Errorf("Script() error = %v, wants FuncMigrationScriptError", err)
+	}
+}
+
+func Test_bindLiterals(t *testing.T) {
+	expectations := []struct {
+		query    string
+		expected string
+	}{
+		{"VALUES (?, ?, ?)", "VALUES ('a', 1, 2.5)"},
+		{"VALUES ($1, $3, $2)", "VALUES ('a', 2.5, 1)"},
+		{"VALUES ($4)", "VALUES ($4)"},
+	}
+
+	for _, expectation := range expectations {
+		actual := bindLiterals(sqlLiteral, expectation.query, "a", int64(1), 2.5)
+
+		if actual != expectation.expected {
+			t.Errorf("Expected %s, got %s", expectation.expected, actual)
+		}
+	}
+}
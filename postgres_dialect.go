@@ -1,45 +1,179 @@
 package darwin
 
+import "fmt"
+
 // PostgresDialect a Dialect configured for PostgreSQL
-type PostgresDialect struct{}
+type PostgresDialect struct {
+	// TableName is the name of the schema table, DefaultTableName if empty
+	TableName string
+
+	// Schema is the schema of the schema table, the search_path is used if empty
+	Schema string
+}
 
 // CreateTableSQL returns the SQL to create the schema table
 func (p PostgresDialect) CreateTableSQL() string {
-	return `CREATE TABLE IF NOT EXISTS darwin_migrations
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
                 (
                     id             SERIAL                  NOT NULL,
-                    version        REAL                    NOT NULL,
+                    version        CHARACTER VARYING (255) NOT NULL,
                     description    CHARACTER VARYING (255) NOT NULL,
-                    checksum       CHARACTER VARYING (32)  NOT NULL,
-                    applied_at     INTEGER                 NOT NULL,
-                    execution_time REAL                    NOT NULL,
-                    UNIQUE         (version),
+                    checksum       CHARACTER VARYING (64)  NOT NULL,
+                    applied_at     TIMESTAMP WITH TIME ZONE NOT NULL,
+                    execution_time BIGINT                  NOT NULL,
+                    success        BOOLEAN                 NOT NULL,
+                    error_message  TEXT                    NOT NULL,
+                    baseline       BOOLEAN                 NOT NULL,
+                    installed_by   CHARACTER VARYING (255) NOT NULL,
+                    hostname       CHARACTER VARYING (255) NOT NULL,
+                    app_version    CHARACTER VARYING (255) NOT NULL,
+                    installed_rank INTEGER                 NOT NULL,
                     PRIMARY KEY    (id)
-                );`
+                );`, p.table())
 }
 
-// InsertSQL returns the SQL to insert a new migration in the schema table
+// InsertSQL returns the SQL to insert a new migration in the schema table,
+// the rank follows the last one and installed_by defaults to the current user
 func (p PostgresDialect) InsertSQL() string {
-	return `INSERT INTO darwin_migrations
+	return fmt.Sprintf(`INSERT INTO %[1]s
                 (
                     version,
                     description,
                     checksum,
                     applied_at,
-                    execution_time
+                    execution_time,
+                    success,
+                    error_message,
+                    baseline,
+                    installed_by,
+                    hostname,
+                    app_version,
+                    installed_rank
                 )
-            VALUES ($1, $2, $3, $4, $5);`
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, COALESCE(NULLIF($9, ''), current_user), $10, $11,
+                (SELECT COALESCE(MAX(installed_rank), 0) + 1 FROM %[1]s));`, p.table())
 }
 
 // AllSQL returns a SQL to get all entries in the table
 func (p PostgresDialect) AllSQL() string {
-	return `SELECT 
+	return fmt.Sprintf(`SELECT 
                 version,
                 description,
                 checksum,
                 applied_at,
-                execution_time
+                execution_time,
+                success,
+                error_message,
+                baseline,
+                installed_by,
+                hostname,
+                app_version,
+                installed_rank
             FROM 
-                darwin_migrations
-            ORDER BY version ASC;`
+                %s
+            ORDER BY version ASC, id ASC;`, p.table())
+}
+
+// DeleteSQL returns the SQL to remove the entry of a version from the schema table
+func (p PostgresDialect) DeleteSQL() string {
+	return fmt.Sprintf(`DELETE FROM %s WHERE version = $1;`, p.table())
+}
+
+// UpdateChecksumSQL returns the SQL to replace the checksum of a version
+func (p PostgresDialect) UpdateChecksumSQL() string {
+	return fmt.Sprintf(`UPDATE %s SET checksum = $1 WHERE version = $2;`, p.table())
+}
+
+// AdvisoryLockSQL returns the SQL to try to acquire the migration lock
+func (p PostgresDialect) AdvisoryLockSQL() string {
+	return fmt.Sprintf("SELECT pg_try_advisory_lock(%d);", advisoryLockKey(p.table()))
+}
+
+// AdvisoryUnlockSQL returns the SQL to release the migration lock
+func (p PostgresDialect) AdvisoryUnlockSQL() string {
+	return fmt.Sprintf("SELECT pg_advisory_unlock(%d);", advisoryLockKey(p.table()))
+}
+
+// CreateSchemaVersionTableSQL returns the SQL to create the schema version table
+func (p PostgresDialect) CreateSchemaVersionTableSQL() string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                (
+                    version INTEGER NOT NULL
+                );`, p.schemaVersionTable())
+}
+
+// SchemaVersionSQL returns a query for the version of the schema table
+func (p PostgresDialect) SchemaVersionSQL() string {
+	return fmt.Sprintf(`SELECT MAX(version) FROM %s;`, p.schemaVersionTable())
+}
+
+// InsertSchemaVersionSQL returns the SQL to store a new version of the schema table
+func (p PostgresDialect) InsertSchemaVersionSQL() string {
+	return fmt.Sprintf(`INSERT INTO %s (version) VALUES ($1);`, p.schemaVersionTable())
+}
+
+// ColumnsSQL returns a query for the names of the columns of the schema table
+func (p PostgresDialect) ColumnsSQL() string {
+	schema := "current_schema()"
+
+	if p.Schema != "" {
+		schema = sqlLiteral(p.Schema)
+	}
+
+	return fmt.Sprintf(`SELECT column_name
+            FROM information_schema.columns
+            WHERE table_schema = %s AND table_name = %s;`, schema, sqlLiteral(tableName(p.TableName)))
+}
+
+// UpgradeSQL returns the script upgrading the schema table from version
+func (p PostgresDialect) UpgradeSQL(version int) string {
+	switch version {
+	case 1:
+		return fmt.Sprintf(`ALTER TABLE %s
+                DROP CONSTRAINT IF EXISTS %s,
+                ALTER COLUMN version TYPE CHARACTER VARYING (255) USING version::text,
+                ALTER COLUMN checksum TYPE CHARACTER VARYING (64),
+                ADD COLUMN success BOOLEAN NOT NULL DEFAULT TRUE,
+                ADD COLUMN error_message TEXT NOT NULL DEFAULT '',
+                ADD COLUMN baseline BOOLEAN NOT NULL DEFAULT FALSE;`,
+			p.table(), quoteIdentifier(tableName(p.TableName)+"_version_key", `"`))
+	case 2:
+		return fmt.Sprintf(`ALTER TABLE %s
+                ALTER COLUMN applied_at TYPE TIMESTAMP WITH TIME ZONE USING to_timestamp(applied_at),
+                ALTER COLUMN execution_time TYPE BIGINT USING round(execution_time)::BIGINT;`, p.table())
+	case 3:
+		return fmt.Sprintf(`ALTER TABLE %[1]s
+                ADD COLUMN installed_by CHARACTER VARYING (255) NOT NULL DEFAULT '',
+                ADD COLUMN hostname CHARACTER VARYING (255) NOT NULL DEFAULT '',
+                ADD COLUMN app_version CHARACTER VARYING (255) NOT NULL DEFAULT '',
+                ADD COLUMN installed_rank INTEGER;
+            UPDATE %[1]s AS m SET installed_rank = r.installed_rank
+                FROM (SELECT id, ROW_NUMBER() OVER (ORDER BY id) AS installed_rank FROM %[1]s) AS r
+                WHERE m.id = r.id;
+            ALTER TABLE %[1]s ALTER COLUMN installed_rank SET NOT NULL;`, p.table())
+	default:
+		return ""
+	}
+}
+
+// SplitStatements splits script in statements, it understands dollar quoted
+// strings, like function bodies, and keeps BEGIN ATOMIC bodies together
+func (p PostgresDialect) SplitStatements(script string) []string {
+	return splitStatements(script, splitOptions{
+		escapeStrings:  true,
+		dollarQuotes:   true,
+		dashComments:   true,
+		nestedComments: true,
+		beginAtomic:    true,
+	})
+}
+
+// table returns the quoted name of the schema table
+func (p PostgresDialect) table() string {
+	return qualifiedName(p.Schema, tableName(p.TableName), `"`)
+}
+
+// schemaVersionTable returns the quoted name of the schema version table
+func (p PostgresDialect) schemaVersionTable() string {
+	return qualifiedName(p.Schema, tableName(p.TableName)+"_schema_version", `"`)
 }
@@ -1,45 +1,291 @@
 package darwin
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
 //QLDialect implements Dialect interface for ql database
 type QLDialect struct {
+	// TableName is the name of the schema table, DefaultTableName if empty.
+	// QL does not quote identifiers nor have schemas, it must be a valid
+	// QL identifier.
+	TableName string
 }
 
 // CreateTableSQL returns the SQL to create the schema table
-func (QLDialect) CreateTableSQL() string {
-	return `
-CREATE TABLE IF NOT EXISTS darwin_migrations(
-	version float,
+func (q QLDialect) CreateTableSQL() string {
+	return fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %[1]s(
+	version string,
 	description string,
 	checksum string,
-	applied_at int64,
+	applied_at time,
 	execution_time int64,
+	success bool,
+	error_message string,
+	baseline bool,
+	installed_by string,
+	hostname string,
+	app_version string,
+	installed_rank int64,
 );
-CREATE UNIQUE INDEX IF NOT EXISTS idx_versions on darwin_migrations(version);
-	`
+CREATE INDEX IF NOT EXISTS %[2]s on %[1]s(version);
+	`, q.table(), q.versionIndex())
 }
 
-// InsertSQL returns the SQL to insert a new migration in the schema table
-func (QLDialect) InsertSQL() string {
-	return `INSERT INTO darwin_migrations
+// InsertSQL returns the SQL to insert a new migration in the schema table,
+// the rank follows the last one. QL has no coalesce, so the first entry is
+// inserted by the second statement, only when the table is empty.
+func (q QLDialect) InsertSQL() string {
+	return fmt.Sprintf(`INSERT INTO %[1]s
+                (
+                    version,
+                    description,
+                    checksum,
+                    applied_at,
+                    execution_time,
+                    success,
+                    error_message,
+                    baseline,
+                    installed_by,
+                    hostname,
+                    app_version,
+                    installed_rank
+                )
+            SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, n + 1
+            FROM (SELECT max(installed_rank) AS n FROM %[1]s)
+            WHERE n IS NOT NULL;
+            INSERT INTO %[1]s
                 (
                     version,
                     description,
                     checksum,
                     applied_at,
-                    execution_time
+                    execution_time,
+                    success,
+                    error_message,
+                    baseline,
+                    installed_by,
+                    hostname,
+                    app_version,
+                    installed_rank
                 )
-            VALUES ($1, $2, $3, $4, $5);`
+            SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, int64(1)
+            FROM (SELECT count() AS n FROM %[1]s)
+            WHERE n == 0;`, q.table())
 }
 
 // AllSQL returns a SQL to get all entries in the table
-func (QLDialect) AllSQL() string {
-	return `SELECT
+func (q QLDialect) AllSQL() string {
+	return fmt.Sprintf(`SELECT
                 version,
                 description,
                 checksum,
                 applied_at,
-                execution_time
+                execution_time,
+                success,
+                error_message,
+                baseline,
+                installed_by,
+                hostname,
+                app_version,
+                installed_rank
             FROM 
-                darwin_migrations
-            ORDER BY version ASC;`
+                %s
+            ORDER BY version, id() ASC;`, q.table())
+}
+
+// DeleteSQL returns the SQL to remove the entry of a version from the schema table
+func (q QLDialect) DeleteSQL() string {
+	return fmt.Sprintf(`DELETE FROM %s WHERE version == $1;`, q.table())
+}
+
+// UpdateChecksumSQL returns the SQL to replace the checksum of a version
+func (q QLDialect) UpdateChecksumSQL() string {
+	return fmt.Sprintf(`UPDATE %s SET checksum = $1 WHERE version == $2;`, q.table())
+}
+
+// CreateLockTableSQL returns the SQL to create the lock table
+func (q QLDialect) CreateLockTableSQL() string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s(
+	id int,
+);`, q.lockTable())
+}
+
+// InsertLockSQL returns the SQL to acquire the migration lock
+func (q QLDialect) InsertLockSQL() string {
+	return fmt.Sprintf(`INSERT INTO %[1]s (id)
+            SELECT 1 FROM (SELECT count() AS n FROM %[1]s) WHERE n == 0;`, q.lockTable())
+}
+
+// DeleteLockSQL returns the SQL to release the migration lock
+func (q QLDialect) DeleteLockSQL() string {
+	return fmt.Sprintf(`DELETE FROM %s;`, q.lockTable())
+}
+
+// CreateSchemaVersionTableSQL returns the SQL to create the schema version table
+func (q QLDialect) CreateSchemaVersionTableSQL() string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s(
+	version int64,
+);`, q.schemaVersionTable())
+}
+
+// SchemaVersionSQL returns a query for the version of the schema table
+func (q QLDialect) SchemaVersionSQL() string {
+	return fmt.Sprintf(`SELECT max(version) FROM %s;`, q.schemaVersionTable())
+}
+
+// InsertSchemaVersionSQL returns the SQL to store a new version of the schema table
+func (q QLDialect) InsertSchemaVersionSQL() string {
+	return fmt.Sprintf(`INSERT INTO %s (version) VALUES (int64($1));`, q.schemaVersionTable())
+}
+
+// ColumnsSQL returns a query for the names of the columns of the schema table
+func (q QLDialect) ColumnsSQL() string {
+	return fmt.Sprintf(`SELECT Name FROM __Column WHERE TableName == %q;`, q.table())
+}
+
+// UpgradeSQL returns the script upgrading the schema table from version.
+// QL cannot change the type of a column, so the table is copied.
+func (q QLDialect) UpgradeSQL(version int) string {
+	switch version {
+	case 1:
+		return fmt.Sprintf(`
+DROP INDEX IF EXISTS idx_versions;
+CREATE TABLE %[2]s(
+	version float,
+	description string,
+	checksum string,
+	applied_at int64,
+	execution_time int64,
+);
+INSERT INTO %[2]s SELECT version, description, checksum, applied_at, execution_time FROM %[1]s;
+DROP TABLE %[1]s;
+CREATE TABLE %[1]s(
+	version string,
+	description string,
+	checksum string,
+	applied_at int64,
+	execution_time int64,
+	success bool,
+	error_message string,
+	baseline bool,
+);
+CREATE INDEX %[3]s on %[1]s(version);
+INSERT INTO %[1]s
+	SELECT formatFloat(version), description, checksum, applied_at, execution_time, true, "", false
+	FROM %[2]s;
+DROP TABLE %[2]s;
+	`, q.table(), q.table()+"_v1", q.versionIndex())
+	case 2:
+		return fmt.Sprintf(`
+CREATE TABLE %[2]s(
+	version string,
+	description string,
+	checksum string,
+	applied_at int64,
+	execution_time int64,
+	success bool,
+	error_message string,
+	baseline bool,
+);
+INSERT INTO %[2]s
+	SELECT version, description, checksum, applied_at, execution_time, success, error_message, baseline
+	FROM %[1]s
+	ORDER BY id();
+DROP INDEX IF EXISTS %[3]s;
+DROP TABLE %[1]s;
+CREATE TABLE %[1]s(
+	version string,
+	description string,
+	checksum string,
+	applied_at time,
+	execution_time int64,
+	success bool,
+	error_message string,
+	baseline bool,
+);
+CREATE INDEX %[3]s on %[1]s(version);
+INSERT INTO %[1]s
+	SELECT version, description, checksum, date(1970, 1, 1, 0, 0, applied_at, 0, "UTC"), execution_time, success, error_message, baseline
+	FROM %[2]s
+	ORDER BY id();
+DROP TABLE %[2]s;
+	`, q.table(), q.table()+"_v2", q.versionIndex())
+	case 3:
+		// QL cannot number the rows, the ranks are set by setRankSQL
+		return fmt.Sprintf(`
+ALTER TABLE %[1]s ADD installed_by string;
+ALTER TABLE %[1]s ADD hostname string;
+ALTER TABLE %[1]s ADD app_version string;
+ALTER TABLE %[1]s ADD installed_rank int64;
+UPDATE %[1]s SET installed_by = "", hostname = "", app_version = "";
+	`, q.table())
+	default:
+		return ""
+	}
+}
+
+// rankRowsSQL returns the ids of the rows in the order they were applied
+func (q QLDialect) rankRowsSQL() string {
+	return fmt.Sprintf(`SELECT id() FROM %s ORDER BY id();`, q.table())
+}
+
+// setRankSQL sets the installed_rank of the row with the id
+func (q QLDialect) setRankSQL() string {
+	return fmt.Sprintf(`UPDATE %s SET installed_rank = $1 WHERE id() == $2;`, q.table())
+}
+
+// noTx returns false, QL updates the database only inside a transaction
+func (q QLDialect) noTx() bool {
+	return false
+}
+
+// SplitStatements splits script in statements
+func (q QLDialect) SplitStatements(script string) []string {
+	return splitStatements(script, splitOptions{
+		backslashEscapes: true,
+		backticks:        true,
+		slashComments:    true,
+	})
+}
+
+// literal formats v as a QL literal, strings are Go strings and times are
+// built by date
+func (q QLDialect) literal(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return strconv.Quote(v)
+	case time.Time:
+		v = v.UTC()
+
+		return fmt.Sprintf(`date(%d, %d, %d, %d, %d, %d, %d, "UTC")`,
+			v.Year(), v.Month(), v.Day(), v.Hour(), v.Minute(), v.Second(), v.Nanosecond())
+	default:
+		return sqlLiteral(v)
+	}
+}
+
+// comment formats text as a QL comment, QL has no -- comments
+func (q QLDialect) comment(text string) string {
+	return "// " + strings.Replace(text, "\n", " ", -1)
+}
+
+func (q QLDialect) table() string {
+	return tableName(q.TableName)
+}
+
+func (q QLDialect) lockTable() string {
+	return q.table() + "_lock"
+}
+
+func (q QLDialect) schemaVersionTable() string {
+	return q.table() + "_schema_version"
+}
+
+func (q QLDialect) versionIndex() string {
+	return "idx_" + q.table() + "_versions"
 }
@@ -1,9 +1,11 @@
 package darwin
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"testing"
+	"time"
 
 	_ "github.com/cznic/ql/driver"
 )
@@ -11,7 +13,7 @@ import (
 func TestQLDialect(t *testing.T) {
 	migrations := []Migration{
 		{
-			Version:     1,
+			Version:     "1",
 			Description: "Creating table posts",
 			Script: `CREATE TABLE posts (
 						id int,
@@ -19,7 +21,7 @@ func TestQLDialect(t *testing.T) {
 					 );;`,
 		},
 		{
-			Version:     2,
+			Version:     "2",
 			Description: "Adding column body",
 			Script:      "ALTER TABLE posts ADD body string;",
 		},
@@ -44,6 +46,596 @@ func TestQLDialect(t *testing.T) {
 	}
 }
 
+func TestQLDialect_TableName(t *testing.T) {
+	core := []Migration{
+		{
+			Version:     "1",
+			Description: "Creating table posts",
+			Script:      "CREATE TABLE posts (id int, title string);",
+		},
+	}
+	plugin := []Migration{
+		{
+			Version:     "1",
+			Description: "Creating table comments",
+			Script:      "CREATE TABLE comments (id int, body string);",
+		},
+	}
+	db, err := sql.Open("ql-mem", "tables.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := New(NewGenericDriver(db, QLDialect{}), core, nil).Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := New(NewGenericDriver(db, QLDialect{TableName: "plugin_migrations"}), plugin, nil).Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if !hasTable(db, "comments", t) {
+		t.Error("expected the table comments to exist")
+	}
+	if !hasTable(db, "plugin_migrations", t) {
+		t.Error("expected the table plugin_migrations to exist")
+	}
+}
+
+func TestQLDialect_Repair(t *testing.T) {
+	migrations := []Migration{
+		{
+			Version:     "1",
+			Description: "Creating table posts",
+			Script:      "CREATE TABLE posts (id int, title string);",
+		},
+		{
+			Version:     "2",
+			Description: "Adding column body to a missing table",
+			Script:      "ALTER TABLE missing ADD body string;",
+		},
+	}
+	db, err := sql.Open("ql-mem", "repair.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := New(NewGenericDriver(db, QLDialect{}), migrations, nil)
+	if err := d.Migrate(); err == nil {
+		t.Fatal("expected the second migration to fail")
+	}
+	if _, ok := d.Migrate().(FailedMigrationError); !ok {
+		t.Fatal("expected FailedMigrationError")
+	}
+	changes, err := d.Repair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Record.Version != "2" {
+		t.Errorf("expected the failed migration to be removed got %v", changes)
+	}
+	migrations[1].Script = "ALTER TABLE posts ADD body string;"
+	if err := New(NewGenericDriver(db, QLDialect{}), migrations, nil).Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if cols := getAllColumns(db, "posts", t); len(cols) != 3 {
+		t.Errorf("expected 3 columns got %d", len(cols))
+	}
+}
+
+func TestQLDialect_Baseline(t *testing.T) {
+	migrations := []Migration{
+		{
+			Version:     "1",
+			Description: "Creating table posts",
+			Script:      "CREATE TABLE posts (id int, title string);",
+		},
+		{
+			Version:     "2",
+			Description: "Adding column body",
+			Script:      "ALTER TABLE posts ADD body string;",
+		},
+	}
+	db, err := sql.Open("ql-mem", "baseline.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec(migrations[0].Script); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	d := New(NewGenericDriver(db, QLDialect{}), migrations, nil)
+	if err := d.Baseline("1", "Existing schema"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if cols := getAllColumns(db, "posts", t); len(cols) != 3 {
+		t.Errorf("expected 3 columns got %d", len(cols))
+	}
+}
+
+func TestQLDialect_Undo(t *testing.T) {
+	migrations := []Migration{
+		{
+			Version:     "1",
+			Description: "Creating table posts",
+			Script:      "CREATE TABLE posts (id int, title string);",
+			UndoScript:  "DROP TABLE posts;",
+		},
+		{
+			Version:     "2",
+			Description: "Adding column body",
+			Script:      "ALTER TABLE posts ADD body string;",
+			UndoScript:  "ALTER TABLE posts DROP COLUMN body;",
+		},
+	}
+	db, err := sql.Open("ql-mem", "undo.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := New(NewGenericDriver(db, QLDialect{}), migrations, nil)
+	if err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Undo("1"); err != nil {
+		t.Fatal(err)
+	}
+	if cols := getAllColumns(db, "posts", t); len(cols) != 2 {
+		t.Errorf("expected 2 columns got %d", len(cols))
+	}
+	if err := d.Undo("0"); err != nil {
+		t.Fatal(err)
+	}
+	if hasTable(db, "posts", t) {
+		t.Error("expected the table posts to be dropped")
+	}
+	if err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if cols := getAllColumns(db, "posts", t); len(cols) != 3 {
+		t.Errorf("expected 3 columns got %d", len(cols))
+	}
+}
+
+func TestQLDialect_Func(t *testing.T) {
+	migrations := []Migration{
+		{
+			Version:     "1",
+			Description: "Creating table posts",
+			Script:      "CREATE TABLE posts (id int, title string);",
+		},
+		{
+			Version:     "2",
+			Description: "Backfilling posts",
+			Func: func(ctx context.Context, tx *sql.Tx) error {
+				for i := 1; i <= 3; i++ {
+					if _, err := tx.ExecContext(ctx, "INSERT INTO posts VALUES ($1, $2);", i, "untitled"); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			FuncChecksum: "backfill-v1",
+		},
+	}
+	db, err := sql.Open("ql-mem", "func.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := New(NewGenericDriver(db, QLDialect{}), migrations, nil)
+	if err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	if err := db.QueryRow("SELECT count(*) FROM posts;").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("expected 3 posts got %d", count)
+	}
+	if err := d.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestQLDialect_NoTransaction(t *testing.T) {
+	migrations := []Migration{
+		{Version: "1", Description: "Creating table posts", Script: "CREATE TABLE posts (id int, title string);"},
+		{Version: "2", Description: "Adding column body", Script: "ALTER TABLE posts ADD body string;", NoTransaction: true},
+	}
+	db, err := sql.Open("ql-mem", "no_transaction.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver := NewGenericDriver(db, QLDialect{})
+	if err := New(driver, migrations, nil).Migrate(); err != ErrNoTxNotSupported {
+		t.Fatalf("Migrate() error = %v, wants ErrNoTxNotSupported", err)
+	}
+	records, err := driver.All()
+	if err != nil || len(records) != 0 {
+		t.Errorf("All() = %v %v, wants no records", records, err)
+	}
+	if _, err := driver.ExecNoTx(context.Background(), "CREATE TABLE posts (id int);"); err != ErrNoTxNotSupported {
+		t.Errorf("ExecNoTx() error = %v, wants ErrNoTxNotSupported", err)
+	}
+}
+
+func TestQLDialect_Repeatable(t *testing.T) {
+	migrations := []Migration{
+		{
+			Description: "Posts summary",
+			Script:      "DROP TABLE IF EXISTS summary; CREATE TABLE summary (total int);",
+			Repeatable:  true,
+		},
+		{
+			Version:     "1",
+			Description: "Creating table posts",
+			Script:      "CREATE TABLE posts (id int, title string);",
+		},
+	}
+	db, err := sql.Open("ql-mem", "repeatable.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := New(NewGenericDriver(db, QLDialect{}), migrations, nil).Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	migrations[0].Script = "DROP TABLE IF EXISTS summary; CREATE TABLE summary (total int, title string);"
+	d := New(NewGenericDriver(db, QLDialect{}), migrations, nil)
+	if err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if cols := getAllColumns(db, "summary", t); len(cols) != 2 {
+		t.Errorf("expected 2 columns got %d", len(cols))
+	}
+	info, err := d.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range info {
+		if i.Status != Applied {
+			t.Errorf("expected %s to be applied got %s", i.Migration.Description, i.Status)
+		}
+	}
+}
+
+func TestQLDialect_Lock(t *testing.T) {
+	db, err := sql.Open("ql-mem", "lock.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockRetryInterval = time.Millisecond
+	defer func() { lockRetryInterval = time.Second }()
+
+	first := NewGenericDriver(db, QLDialect{})
+	second := NewGenericDriver(db, QLDialect{})
+
+	if err := first.Lock(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+	err = second.Lock(context.Background(), 10*time.Millisecond)
+	if _, ok := err.(LockTimeoutError); !ok {
+		t.Errorf("expected LockTimeoutError got %v", err)
+	}
+	if err := first.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Lock(context.Background(), 10*time.Millisecond); err != nil {
+		t.Errorf("expected the lock to be released got %v", err)
+	}
+}
+
+func TestQLDialect_ForceUnlock(t *testing.T) {
+	db, err := sql.Open("ql-mem", "force_unlock.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockRetryInterval = time.Millisecond
+	defer func() { lockRetryInterval = time.Second }()
+
+	// The first process is killed holding the lock
+	killed := NewGenericDriver(db, QLDialect{})
+	if err := killed.Lock(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	driver := NewGenericDriver(db, QLDialect{})
+	err = driver.Lock(context.Background(), 10*time.Millisecond)
+	if _, ok := err.(LockTimeoutError); !ok {
+		t.Errorf("expected LockTimeoutError got %v", err)
+	}
+	if err := driver.ForceUnlock(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Lock(context.Background(), 10*time.Millisecond); err != nil {
+		t.Errorf("expected the lock to be released got %v", err)
+	}
+}
+
+func TestQLDialect_Upgrade(t *testing.T) {
+	db, err := sql.Open("ql-mem", "upgrade.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The schema table created by the first releases
+	legacy := []string{
+		`CREATE TABLE darwin_migrations(
+			version float,
+			description string,
+			checksum string,
+			applied_at int64,
+			execution_time int64,
+		);`,
+		`CREATE UNIQUE INDEX idx_versions on darwin_migrations(version);`,
+		`INSERT INTO darwin_migrations VALUES (1.0, "Creating table posts", "8a5e3f5bd5dfd1f2ebb8ea48bbe46e7d", 1475270400, 1000);`,
+		`INSERT INTO darwin_migrations VALUES (1.1, "Adding column body", "0a5fda3cab20aa65d5e8e8bc3c06fb45", 1475270401, 1000);`,
+		`CREATE TABLE posts (id int, title string, body string);`,
+	}
+	for _, stmt := range legacy {
+		if err := transaction(db, func(tx *sql.Tx) error {
+			_, err := tx.Exec(stmt)
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	migrations := []Migration{
+		{Version: "1", Description: "Creating table posts", Script: "CREATE TABLE posts (id int, title string);"},
+		{Version: "1.1", Description: "Adding column body", Script: "ALTER TABLE posts ADD body string;"},
+		{Version: "2", Description: "Adding column author", Script: "ALTER TABLE posts ADD author string;"},
+	}
+	driver := NewGenericDriver(db, QLDialect{})
+	d := New(driver, migrations, nil)
+
+	if _, err := d.Repair(); err != nil {
+		t.Fatalf("Repair() error = %s, wants nil", err)
+	}
+	if err := d.Migrate(); err != nil {
+		t.Fatalf("Migrate() error = %s, wants nil", err)
+	}
+
+	records, err := driver.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[0].Version != "1" || records[1].Version != "1.1" || records[2].Version != "2" {
+		t.Fatalf("Unexpected records after the upgrade %+v", records)
+	}
+	if records[1].Failed || records[1].Baseline || records[1].AppliedAt.Unix() != 1475270401 {
+		t.Errorf("The upgrade must keep the applied migrations, got %+v", records[1])
+	}
+	for i, record := range records {
+		if record.Rank != i+1 {
+			t.Errorf("records[%d].Rank = %d, wants %d", i, record.Rank, i+1)
+		}
+	}
+
+	version, err := driver.schemaVersion(context.Background(), QLDialect{})
+	if err != nil || version != SchemaVersion {
+		t.Errorf("schemaVersion() = %d %v, wants %d", version, err, SchemaVersion)
+	}
+	if hasTable(db, "darwin_migrations_v1", t) {
+		t.Error("The copy of the legacy table must be dropped")
+	}
+}
+
+func TestQLDialect_Create_without_version(t *testing.T) {
+	db, err := sql.Open("ql-mem", "without_version.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Created by hand, like by the script of a plan
+	if err := transaction(db, func(tx *sql.Tx) error {
+		_, err := tx.Exec(QLDialect{}.CreateTableSQL())
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	driver := NewGenericDriver(db, QLDialect{})
+	if err := driver.Create(); err != nil {
+		t.Fatalf("Create() error = %s, wants nil", err)
+	}
+
+	migrations := []Migration{
+		{Version: "1", Description: "Creating table posts", Script: "CREATE TABLE posts (id int, title string);"},
+	}
+	if err := New(driver, migrations, nil).Migrate(); err != nil {
+		t.Fatalf("Migrate() error = %s, wants nil", err)
+	}
+
+	records, err := driver.All()
+	if err != nil || len(records) != 1 || records[0].Rank != 1 {
+		t.Errorf("All() = %+v %v, wants the migration", records, err)
+	}
+}
+
+func TestQLDialect_InstalledBy(t *testing.T) {
+	db, err := sql.Open("ql-mem", "installed_by.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrations := []Migration{
+		{Version: "1", Description: "Creating table posts", Script: "CREATE TABLE posts (id int, title string);"},
+		{Version: "2", Description: "Adding column body", Script: "ALTER TABLE posts ADD body string;"},
+	}
+	driver := NewGenericDriver(db, QLDialect{})
+	d := New(driver, migrations, nil)
+	d.InstalledBy = "deploy"
+	d.AppVersion = "2.3.0"
+
+	if err := d.Migrate(); err != nil {
+		t.Fatalf("Migrate() error = %s, wants nil", err)
+	}
+
+	records, err := driver.All()
+	if err != nil || len(records) != 2 {
+		t.Fatalf("All() = %v %v", records, err)
+	}
+	for i, record := range records {
+		if record.InstalledBy != "deploy" || record.Hostname != hostname() || record.AppVersion != "2.3.0" || record.Rank != i+1 {
+			t.Errorf("Unexpected record %+v", record)
+		}
+	}
+
+	infos, err := d.Info()
+	if err != nil || len(infos) != 2 || infos[1].Record == nil || infos[1].Record.Rank != 2 {
+		t.Errorf("Info() = %+v %v, wants the records", infos, err)
+	}
+}
+
+func TestQLDialect_PlanScript(t *testing.T) {
+	db, err := sql.Open("ql-mem", "plan_script.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrations := []Migration{
+		{Version: "1", Description: "Creating table \"posts\"", Script: "CREATE TABLE posts (id int, title string);"},
+		{Version: "2", Description: "Bobby's posts", Script: "INSERT INTO posts VALUES (1, \"Bobby's\");"},
+	}
+	plan := MigrationPlan{Migrations: migrations}
+
+	script, err := plan.Script(QLDialect{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := transaction(db, func(tx *sql.Tx) error {
+		_, err := tx.Exec(script)
+		return err
+	}); err != nil {
+		t.Fatalf("Executing the script failed: %s\n%s", err, script)
+	}
+
+	driver := NewGenericDriver(db, QLDialect{})
+	records, err := driver.All()
+	if err != nil || len(records) != 2 || records[0].Description != migrations[0].Description || records[1].Rank != 2 {
+		t.Fatalf("All() = %+v %v, wants the migrations of the script", records, err)
+	}
+
+	// The schema table is up to date and the migrations applied
+	if err := New(driver, migrations, nil).Migrate(); err != nil {
+		t.Errorf("Migrate() error = %s, wants nil", err)
+	}
+	records, err = driver.All()
+	if err != nil || len(records) != 2 {
+		t.Errorf("All() = %+v %v, wants no new migrations", records, err)
+	}
+}
+
+func TestQLDialect_Plan_read_only(t *testing.T) {
+	db, err := sql.Open("ql-mem", "plan_read_only.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrations := []Migration{
+		{Version: "1", Description: "Creating table posts", Script: "CREATE TABLE posts (id int, title string);"},
+	}
+	d := New(NewGenericDriver(db, QLDialect{}), migrations, nil)
+
+	plan, err := d.Plan()
+	if err != nil || plan.ValidationError != nil || len(plan.Migrations) != 1 {
+		t.Errorf("Plan() = %+v %v, wants the migration", plan, err)
+	}
+	if hasTable(db, "darwin_migrations", t) || hasTable(db, "darwin_migrations_schema_version", t) {
+		t.Error("Plan() must not create the schema table")
+	}
+
+	// A schema table created by the first releases
+	if err := transaction(db, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`CREATE TABLE darwin_migrations(
+			version float,
+			description string,
+			checksum string,
+			applied_at int64,
+			execution_time int64,
+		);`)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := d.Plan(); err != (OutdatedSchemaError{Version: legacySchemaVersion}) {
+		t.Errorf("Plan() error = %v, wants OutdatedSchemaError", err)
+	}
+	if cols := getAllColumns(db, "darwin_migrations", t); len(cols) != 5 {
+		t.Errorf("Plan() must not upgrade the schema table, got the columns %v", cols)
+	}
+}
+
+func TestQLDialect_Info_fresh(t *testing.T) {
+	db, err := sql.Open("ql-mem", "info_fresh.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrations := []Migration{
+		{Version: "1", Description: "Creating table posts", Script: "CREATE TABLE posts (id int, title string);"},
+		{Description: "Posts count", Script: "CREATE TABLE IF NOT EXISTS posts_count (n int);", Repeatable: true},
+	}
+	d := New(NewGenericDriver(db, QLDialect{}), migrations, nil)
+
+	infos, err := d.Info()
+	if err != nil || len(infos) != 2 {
+		t.Fatalf("Info() = %v %v, wants the migrations", infos, err)
+	}
+	for _, info := range infos {
+		if info.Status != Pending {
+			t.Errorf("Info() status = %s, wants PENDING", info.Status)
+		}
+	}
+	if err := d.Validate(); err != nil {
+		t.Errorf("Validate() error = %s, wants nil", err)
+	}
+	if hasTable(db, "darwin_migrations", t) {
+		t.Error("Info() must not create the schema table")
+	}
+}
+
+func TestQLDialect_AppliedAt(t *testing.T) {
+	db, err := sql.Open("ql-mem", "applied_at.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	driver := NewGenericDriver(db, QLDialect{})
+	if err := driver.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	record := MigrationRecord{
+		Version:       "1",
+		Description:   "Creating table posts",
+		AppliedAt:     time.Date(2016, 10, 1, 9, 30, 0, 123456789, time.FixedZone("BRT", -3*60*60)),
+		ExecutionTime: 1500*time.Millisecond + 7,
+	}
+	if err := driver.Insert(record); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := driver.All()
+	if err != nil || len(records) != 1 {
+		t.Fatalf("All() = %v %v", records, err)
+	}
+
+	expected := time.Date(2016, 10, 1, 12, 30, 0, 123456000, time.UTC)
+	if records[0].AppliedAt != expected {
+		t.Errorf("AppliedAt = %v, wants %v", records[0].AppliedAt, expected)
+	}
+	if records[0].ExecutionTime != record.ExecutionTime {
+		t.Errorf("ExecutionTime = %v, wants %v", records[0].ExecutionTime, record.ExecutionTime)
+	}
+}
+
 func hasTable(db *sql.DB, tableName string, t *testing.T) bool {
 	querry := "select count() from __Table where Name=$1"
 	var count int
@@ -0,0 +1,123 @@
+package darwin
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrRepairNotSupported is returned by Repair when the driver is not a RepairDriver
+var ErrRepairNotSupported = errors.New("darwin: the driver does not support Repair")
+
+// RepairAction is a kind of change made by Repair
+type RepairAction int
+
+const (
+	// RemovedFailed means that the entry of a failed migration was removed,
+	// so the migration is applied again by Migrate
+	RemovedFailed RepairAction = iota
+	// UpdatedChecksum means that the stored checksum was replaced by the
+	// checksum of the migration
+	UpdatedChecksum
+)
+
+func (r RepairAction) String() string {
+	switch r {
+	case RemovedFailed:
+		return "REMOVED FAILED"
+	case UpdatedChecksum:
+		return "UPDATED CHECKSUM"
+	default:
+		return "INVALID"
+	}
+}
+
+// RepairChange describes a change made by Repair in the schema table
+type RepairChange struct {
+	Action RepairAction
+
+	// Record is the entry before the change
+	Record MigrationRecord
+
+	// Checksum is the new checksum when the Action is UpdatedChecksum
+	Checksum string
+}
+
+// Repair fixes the schema table and returns every change made. The entries of
+// failed migrations are removed; any partial change they made to the schema
+// must be reverted by hand before migrating again. The checksums of applied
+// migrations are updated to match the migrations, use it when a script was
+// intentionally changed, like fixing a comment.
+// If the driver is a Locker, the lock is held during the whole process.
+func (d Darwin) Repair() ([]RepairChange, error) {
+	return d.RepairContext(context.Background())
+}
+
+// RepairContext is like Repair, but it stops when ctx is done
+func (d Darwin) RepairContext(ctx context.Context) ([]RepairChange, error) {
+	changes := []RepairChange{}
+
+	repairer, ok := d.driver.(RepairDriver)
+
+	if !ok {
+		return changes, ErrRepairNotSupported
+	}
+
+	err := d.locked(ctx, func(ctx context.Context) error {
+		err := createContext(ctx, d.driver)
+
+		if err != nil {
+			return err
+		}
+
+		applied, err := allContext(ctx, d.driver)
+
+		if err != nil {
+			return err
+		}
+
+		// Changed repeatable migrations are applied again, not repaired
+		versioned, _ := splitRepeatable(d.migrations)
+		migrations := map[Version]Migration{}
+
+		for _, migration := range versioned {
+			migrations[migration.Version.canonical()] = migration
+		}
+
+		for _, record := range applied {
+			if record.Failed {
+				err = repairer.Delete(ctx, record.Version)
+
+				if err != nil {
+					return err
+				}
+
+				changes = append(changes, RepairChange{Action: RemovedFailed, Record: record})
+				continue
+			}
+
+			migration, ok := migrations[record.Version.canonical()]
+
+			if !ok || record.Baseline || record.Version == "" {
+				continue
+			}
+
+			checksum := d.newRecord(migration).Checksum
+
+			if checksum == record.Checksum {
+				continue
+			}
+
+			err = repairer.UpdateChecksum(ctx, record.Version, checksum)
+
+			if err != nil {
+				return err
+			}
+
+			changes = append(changes, RepairChange{Action: UpdatedChecksum, Record: record, Checksum: checksum})
+		}
+
+		return nil
+	})
+
+	return changes, err
+}
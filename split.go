@@ -0,0 +1,314 @@
+package darwin
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// SplitDialect is implemented by dialects able to split a script in
+// statements, so GenericDriver executes them one by one. It is required by
+// databases rejecting many statements in the same Exec, like MySQL.
+type SplitDialect interface {
+	// SplitStatements returns the statements of script, in order and
+	// without the delimiters. Statements with only comments are dropped.
+	SplitStatements(script string) []string
+}
+
+// StatementError is used to report the statement of a script that failed
+type StatementError struct {
+	// Index is the position of the statement in the script, starting at 1
+	Index     int
+	Statement string
+	Err       error
+}
+
+func (s StatementError) Error() string {
+	return fmt.Sprintf("Statement %d %q failed: %s", s.Index, s.Statement, s.Err)
+}
+
+// Unwrap returns the error returned by the database
+func (s StatementError) Unwrap() error {
+	return s.Err
+}
+
+// splitOptions are the lexical rules of a SQL dialect
+type splitOptions struct {
+	// backslashEscapes enables backslash escapes in quoted strings
+	backslashEscapes bool
+
+	// escapeStrings enables backslash escapes in E'...' strings
+	escapeStrings bool
+
+	// backticks quotes identifiers or raw strings with `
+	backticks bool
+
+	// dollarQuotes enables $tag$...$tag$ strings
+	dollarQuotes bool
+
+	// dashComments enables -- comments, dashSpace requires a space after --
+	dashComments bool
+	dashSpace    bool
+
+	// hashComments enables # comments
+	hashComments bool
+
+	// slashComments enables // comments
+	slashComments bool
+
+	// nestedComments allows /* */ comments inside /* */ comments
+	nestedComments bool
+
+	// delimiterCommand enables the DELIMITER command of the mysql client
+	delimiterCommand bool
+
+	// triggers keeps the BEGIN ... END body of CREATE TRIGGER together
+	triggers bool
+
+	// beginAtomic keeps the BEGIN ATOMIC ... END body of SQL functions and
+	// procedures together
+	beginAtomic bool
+}
+
+var dollarTag = regexp.MustCompile(`^\$(?:[A-Za-z_][A-Za-z0-9_]*)?\$`)
+
+// statementBody follows the words of a statement to find the body whose
+// statements are kept together, the BEGIN ... END body of CREATE TRIGGER or
+// a BEGIN ATOMIC ... END body, counting the CASE ... END expressions inside it
+type statementBody struct {
+	// words are the first words of the statement, in upper case
+	words    []string
+	previous string
+	trigger  bool
+	atomic   bool
+	depth    int
+}
+
+func (b *statementBody) word(w string, o splitOptions) {
+	w = strings.ToUpper(w)
+
+	if len(b.words) < 3 {
+		b.words = append(b.words, w)
+		b.trigger = o.triggers && isCreateTrigger(b.words)
+	}
+
+	switch {
+	case w == "ATOMIC" && b.previous == "BEGIN" && o.beginAtomic && !b.trigger:
+		b.atomic = true
+		b.depth++
+	case !b.trigger && !b.atomic:
+	case w == "BEGIN" && b.trigger, w == "CASE":
+		b.depth++
+	case w == "END":
+		b.depth--
+	}
+
+	b.previous = w
+}
+
+// open reports whether the statement is inside its body
+func (b *statementBody) open() bool {
+	return (b.trigger || b.atomic) && b.depth > 0
+}
+
+// isCreateTrigger reports whether words start CREATE [TEMP|TEMPORARY] TRIGGER
+func isCreateTrigger(words []string) bool {
+	if len(words) < 2 || words[0] != "CREATE" {
+		return false
+	}
+
+	if words[1] == "TRIGGER" {
+		return true
+	}
+
+	return len(words) > 2 && (words[1] == "TEMP" || words[1] == "TEMPORARY") && words[2] == "TRIGGER"
+}
+
+// splitStatements splits script in statements following the rules in o
+func splitStatements(script string, o splitOptions) []string {
+	statements := []string{}
+	delimiter := ";"
+
+	var (
+		current strings.Builder
+		body    statementBody
+	)
+
+	hasCode := false
+
+	flush := func() {
+		if hasCode {
+			statements = append(statements, strings.TrimSpace(current.String()))
+		}
+
+		current.Reset()
+		body = statementBody{}
+		hasCode = false
+	}
+
+	for i := 0; i < len(script); {
+		if o.delimiterCommand && !hasCode && isLineStart(script, i) {
+			if d, next, ok := parseDelimiterCommand(script, i); ok {
+				delimiter = d
+				i = next
+				continue
+			}
+		}
+
+		rest := script[i:]
+		end := i + 1
+
+		switch c := script[i]; {
+		case strings.HasPrefix(rest, delimiter):
+			if body.open() {
+				break
+			}
+
+			flush()
+			i += len(delimiter)
+			continue
+		case c == '\'':
+			backslash := o.backslashEscapes || (o.escapeStrings && isEscapeString(script, i))
+			end = skipQuoted(script, i, '\'', backslash)
+			hasCode = true
+		case c == '"':
+			end = skipQuoted(script, i, '"', o.backslashEscapes)
+			hasCode = true
+		case c == '`' && o.backticks:
+			end = skipQuoted(script, i, '`', false)
+			hasCode = true
+		case c == '$' && o.dollarQuotes && (i == 0 || !isIdentifierChar(script[i-1])) && dollarTag.MatchString(rest):
+			tag := dollarTag.FindString(rest)
+			end = len(script)
+
+			if j := strings.Index(rest[len(tag):], tag); j >= 0 {
+				end = i + len(tag) + j + len(tag)
+			}
+
+			hasCode = true
+		case strings.HasPrefix(rest, "--") && o.dashComments && (!o.dashSpace || len(rest) == 2 || isSpace(rest[2])),
+			c == '#' && o.hashComments,
+			strings.HasPrefix(rest, "//") && o.slashComments:
+			end = len(script)
+
+			if j := strings.IndexByte(rest, '\n'); j >= 0 {
+				end = i + j
+			}
+		case strings.HasPrefix(rest, "/*"):
+			end = skipBlockComment(script, i, o.nestedComments)
+		default:
+			if (o.triggers || o.beginAtomic) && isWordChar(c) {
+				for end < len(script) && isWordChar(script[end]) {
+					end++
+				}
+
+				body.word(script[i:end], o)
+			}
+
+			if !isSpace(c) {
+				hasCode = true
+			}
+		}
+
+		current.WriteString(script[i:end])
+		i = end
+	}
+
+	flush()
+
+	return statements
+}
+
+// skipQuoted returns the index after the string starting at i, quotes are
+// escaped by doubling them or, if backslash is true, with a backslash
+func skipQuoted(script string, i int, quote byte, backslash bool) int {
+	for j := i + 1; j < len(script); j++ {
+		switch script[j] {
+		case '\\':
+			if backslash {
+				j++
+			}
+		case quote:
+			if j+1 < len(script) && script[j+1] == quote {
+				j++
+				continue
+			}
+
+			return j + 1
+		}
+	}
+
+	return len(script)
+}
+
+// skipBlockComment returns the index after the /* */ comment starting at i
+func skipBlockComment(script string, i int, nested bool) int {
+	depth := 0
+
+	for j := i; j < len(script)-1; j++ {
+		switch script[j : j+2] {
+		case "/*":
+			if depth == 0 || nested {
+				depth++
+			}
+
+			j++
+		case "*/":
+			depth--
+			j++
+
+			if depth == 0 {
+				return j + 1
+			}
+		}
+	}
+
+	return len(script)
+}
+
+// parseDelimiterCommand parses a DELIMITER command starting at i, returning
+// the new delimiter and the index of the next line
+func parseDelimiterCommand(script string, i int) (string, int, bool) {
+	next := len(script)
+
+	if j := strings.IndexByte(script[i:], '\n'); j >= 0 {
+		next = i + j + 1
+	}
+
+	fields := strings.Fields(script[i:next])
+
+	if len(fields) != 2 || !strings.EqualFold(fields[0], "DELIMITER") {
+		return "", 0, false
+	}
+
+	return fields[1], next, true
+}
+
+// isLineStart reports whether there is only white space between the
+// beginning of the line and i
+func isLineStart(script string, i int) bool {
+	for j := i - 1; j >= 0 && script[j] != '\n'; j-- {
+		if !isSpace(script[j]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isEscapeString reports whether the string starting at i is like E'...'
+func isEscapeString(script string, i int) bool {
+	return i > 0 && (script[i-1] == 'E' || script[i-1] == 'e') && (i == 1 || !isIdentifierChar(script[i-2]))
+}
+
+func isIdentifierChar(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
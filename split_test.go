@@ -0,0 +1,151 @@
+package darwin
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func Test_SplitStatements(t *testing.T) {
+	expectations := []struct {
+		name     string
+		dialect  SplitDialect
+		script   string
+		expected []string
+	}{
+		{
+			"simple",
+			PostgresDialect{},
+			"CREATE TABLE a (id INT);\nCREATE TABLE b (id INT);\n",
+			[]string{"CREATE TABLE a (id INT)", "CREATE TABLE b (id INT)"},
+		},
+		{
+			"without last delimiter",
+			PostgresDialect{},
+			"SELECT 1; SELECT 2",
+			[]string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			"string literals",
+			PostgresDialect{},
+			"INSERT INTO a VALUES ('a;b', 'it''s;');SELECT \"x;y\" FROM a;",
+			[]string{"INSERT INTO a VALUES ('a;b', 'it''s;')", "SELECT \"x;y\" FROM a"},
+		},
+		{
+			"comments",
+			PostgresDialect{},
+			"-- first; statement\nSELECT 1; /* a ; /* nested; */ comment; */ SELECT 2;\n-- only a comment;",
+			[]string{"-- first; statement\nSELECT 1", "/* a ; /* nested; */ comment; */ SELECT 2"},
+		},
+		{
+			"postgres dollar quotes",
+			PostgresDialect{},
+			"CREATE FUNCTION f() RETURNS INT AS $body$ SELECT 1; $body$ LANGUAGE SQL;\nDO $$ BEGIN PERFORM 1; END $$;",
+			[]string{
+				"CREATE FUNCTION f() RETURNS INT AS $body$ SELECT 1; $body$ LANGUAGE SQL",
+				"DO $$ BEGIN PERFORM 1; END $$",
+			},
+		},
+		{
+			"postgres escape strings",
+			PostgresDialect{},
+			`SELECT E'a\';b'; SELECT 'c\'; SELECT 2;`,
+			[]string{`SELECT E'a\';b'`, `SELECT 'c\'`, "SELECT 2"},
+		},
+		{
+			"postgres parameters are not dollar quotes",
+			PostgresDialect{},
+			"PREPARE p AS SELECT $1; SELECT a$b$ FROM t;",
+			[]string{"PREPARE p AS SELECT $1", "SELECT a$b$ FROM t"},
+		},
+		{
+			"postgres begin atomic",
+			PostgresDialect{},
+			"BEGIN;\nCREATE FUNCTION f() RETURNS INT LANGUAGE SQL\nBEGIN ATOMIC\n  SELECT 1;\n  SELECT CASE WHEN true THEN 2 END;\nEND;\nCOMMIT;",
+			[]string{
+				"BEGIN",
+				"CREATE FUNCTION f() RETURNS INT LANGUAGE SQL\nBEGIN ATOMIC\n  SELECT 1;\n  SELECT CASE WHEN true THEN 2 END;\nEND",
+				"COMMIT",
+			},
+		},
+		{
+			"mysql backslash escapes and comments",
+			MySQLDialect{},
+			"INSERT INTO a VALUES ('a\\';b', \"c\\\";d\");# comment;\nSELECT 1--1;\nSELECT `a;b` FROM t; -- comment;",
+			[]string{"INSERT INTO a VALUES ('a\\';b', \"c\\\";d\")", "# comment;\nSELECT 1--1", "SELECT `a;b` FROM t"},
+		},
+		{
+			"mysql delimiter",
+			MySQLDialect{},
+			"DELIMITER $$\nCREATE PROCEDURE p()\nBEGIN\n  SELECT 1;\n  SELECT 2;\nEND$$\ndelimiter ;\nCALL p();",
+			[]string{"CREATE PROCEDURE p()\nBEGIN\n  SELECT 1;\n  SELECT 2;\nEND", "CALL p()"},
+		},
+		{
+			"sqlite triggers",
+			SqliteDialect{},
+			"CREATE TRIGGER t AFTER INSERT ON a BEGIN\n  UPDATE b SET n = n + 1;\n  DELETE FROM c;\nEND;\nCREATE TEMP TRIGGER u AFTER DELETE ON a BEGIN SELECT 1; END;\nSELECT 1;",
+			[]string{
+				"CREATE TRIGGER t AFTER INSERT ON a BEGIN\n  UPDATE b SET n = n + 1;\n  DELETE FROM c;\nEND",
+				"CREATE TEMP TRIGGER u AFTER DELETE ON a BEGIN SELECT 1; END",
+				"SELECT 1",
+			},
+		},
+		{
+			"sqlite trigger after a comment",
+			SqliteDialect{},
+			"-- counts the posts\nCREATE TRIGGER t AFTER INSERT ON a BEGIN\n  UPDATE b SET n = n + 1;\nEND;\nSELECT 1;",
+			[]string{
+				"-- counts the posts\nCREATE TRIGGER t AFTER INSERT ON a BEGIN\n  UPDATE b SET n = n + 1;\nEND",
+				"SELECT 1",
+			},
+		},
+		{
+			"sqlite trigger with case",
+			SqliteDialect{},
+			"CREATE TRIGGER t AFTER INSERT ON a BEGIN\n  UPDATE b SET n = CASE WHEN new.x THEN 1 ELSE 0 END;\n  SELECT CASE new.y WHEN 1 THEN 'end' END;\nEND;\nSELECT 1;",
+			[]string{
+				"CREATE TRIGGER t AFTER INSERT ON a BEGIN\n  UPDATE b SET n = CASE WHEN new.x THEN 1 ELSE 0 END;\n  SELECT CASE new.y WHEN 1 THEN 'end' END;\nEND",
+				"SELECT 1",
+			},
+		},
+		{
+			"ql strings and comments",
+			QLDialect{},
+			"INSERT INTO a VALUES (\"a\\\";b\", `c;d`); // comment;\nSELECT 1 FROM a;",
+			[]string{"INSERT INTO a VALUES (\"a\\\";b\", `c;d`)", "// comment;\nSELECT 1 FROM a"},
+		},
+		{
+			"unterminated string",
+			PostgresDialect{},
+			"SELECT 1; SELECT 'a;",
+			[]string{"SELECT 1", "SELECT 'a;"},
+		},
+		{
+			"empty",
+			MySQLDialect{},
+			" ;\n; -- nothing\n",
+			[]string{},
+		},
+	}
+
+	for _, expectation := range expectations {
+		actual := expectation.dialect.SplitStatements(expectation.script)
+
+		if !reflect.DeepEqual(actual, expectation.expected) {
+			t.Errorf("%s: SplitStatements() = %q, wants %q", expectation.name, actual, expectation.expected)
+		}
+	}
+}
+
+func Test_StatementError(t *testing.T) {
+	cause := errors.New("syntax error")
+	err := StatementError{Index: 2, Statement: "SELEC 1", Err: cause}
+
+	if err.Error() != `Statement 2 "SELEC 1" failed: syntax error` {
+		t.Errorf("Unexpected error message %q", err.Error())
+	}
+
+	if !errors.Is(err, cause) {
+		t.Error("StatementError must unwrap to the database error")
+	}
+}
@@ -1,44 +1,235 @@
 package darwin
 
+import "fmt"
+
 // SqliteDialect a Dialect configured for Sqlite3
-type SqliteDialect struct{}
+type SqliteDialect struct {
+	// TableName is the name of the schema table, DefaultTableName if empty
+	TableName string
+
+	// Schema is the attached database of the schema table, main if empty
+	Schema string
+}
 
 // CreateTableSQL returns the SQL to create the schema table
 func (s SqliteDialect) CreateTableSQL() string {
-	return `CREATE TABLE IF NOT EXISTS darwin_migrations
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
                 (
                     id             INTEGER  PRIMARY KEY,
-                    version        FLOAT    NOT NULL,
+                    version        TEXT     NOT NULL,
                     description    TEXT     NOT NULL,
                     checksum       TEXT     NOT NULL,
                     applied_at     DATETIME NOT NULL,
-                    execution_time FLOAT    NOT NULL,
-                    UNIQUE         (version)
-                );`
+                    execution_time INTEGER  NOT NULL,
+                    success        BOOLEAN  NOT NULL,
+                    error_message  TEXT     NOT NULL,
+                    baseline       BOOLEAN  NOT NULL,
+                    installed_by   TEXT     NOT NULL,
+                    hostname       TEXT     NOT NULL,
+                    app_version    TEXT     NOT NULL,
+                    installed_rank INTEGER  NOT NULL
+                );`, s.table())
 }
 
-// InsertSQL returns the SQL to insert a new migration in the schema table
+// InsertSQL returns the SQL to insert a new migration in the schema table,
+// the rank follows the last one
 func (s SqliteDialect) InsertSQL() string {
-	return `INSERT INTO darwin_migrations
+	return fmt.Sprintf(`INSERT INTO %[1]s
                 (
                     version,
                     description,
                     checksum,
                     applied_at,
-                    execution_time
+                    execution_time,
+                    success,
+                    error_message,
+                    baseline,
+                    installed_by,
+                    hostname,
+                    app_version,
+                    installed_rank
                 )
-            VALUES (?, ?, ?, ?, ?);`
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?,
+                (SELECT COALESCE(MAX(installed_rank), 0) + 1 FROM %[1]s));`, s.table())
 }
 
 // AllSQL returns a SQL to get all entries in the table
 func (s SqliteDialect) AllSQL() string {
-	return `SELECT 
+	return fmt.Sprintf(`SELECT 
                 version,
                 description,
                 checksum,
                 applied_at,
-                execution_time
+                execution_time,
+                success,
+                error_message,
+                baseline,
+                installed_by,
+                hostname,
+                app_version,
+                installed_rank
             FROM 
-                darwin_migrations
-            ORDER BY version ASC;`
+                %s
+            ORDER BY version ASC, id ASC;`, s.table())
+}
+
+// DeleteSQL returns the SQL to remove the entry of a version from the schema table
+func (s SqliteDialect) DeleteSQL() string {
+	return fmt.Sprintf(`DELETE FROM %s WHERE version = ?;`, s.table())
+}
+
+// UpdateChecksumSQL returns the SQL to replace the checksum of a version
+func (s SqliteDialect) UpdateChecksumSQL() string {
+	return fmt.Sprintf(`UPDATE %s SET checksum = ? WHERE version = ?;`, s.table())
+}
+
+// CreateLockTableSQL returns the SQL to create the lock table
+func (s SqliteDialect) CreateLockTableSQL() string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                (
+                    id INTEGER PRIMARY KEY
+                );`, s.lockTable())
+}
+
+// InsertLockSQL returns the SQL to acquire the migration lock
+func (s SqliteDialect) InsertLockSQL() string {
+	return fmt.Sprintf(`INSERT OR IGNORE INTO %s (id) VALUES (1);`, s.lockTable())
+}
+
+// DeleteLockSQL returns the SQL to release the migration lock
+func (s SqliteDialect) DeleteLockSQL() string {
+	return fmt.Sprintf(`DELETE FROM %s;`, s.lockTable())
+}
+
+// CreateSchemaVersionTableSQL returns the SQL to create the schema version table
+func (s SqliteDialect) CreateSchemaVersionTableSQL() string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                (
+                    version INTEGER NOT NULL
+                );`, s.schemaVersionTable())
+}
+
+// SchemaVersionSQL returns a query for the version of the schema table
+func (s SqliteDialect) SchemaVersionSQL() string {
+	return fmt.Sprintf(`SELECT MAX(version) FROM %s;`, s.schemaVersionTable())
+}
+
+// InsertSchemaVersionSQL returns the SQL to store a new version of the schema table
+func (s SqliteDialect) InsertSchemaVersionSQL() string {
+	return fmt.Sprintf(`INSERT INTO %s (version) VALUES (?);`, s.schemaVersionTable())
+}
+
+// ColumnsSQL returns a query for the names of the columns of the schema table
+func (s SqliteDialect) ColumnsSQL() string {
+	schema := "main"
+
+	if s.Schema != "" {
+		schema = s.Schema
+	}
+
+	return fmt.Sprintf(`SELECT name FROM pragma_table_info(%s, %s);`, sqlLiteral(tableName(s.TableName)), sqlLiteral(schema))
+}
+
+// UpgradeSQL returns the script upgrading the schema table from version.
+// SQLite cannot change the columns, so the table is copied.
+func (s SqliteDialect) UpgradeSQL(version int) string {
+	switch version {
+	case 1:
+		return fmt.Sprintf(`ALTER TABLE %[1]s RENAME TO %[2]s;
+            CREATE TABLE %[1]s
+                (
+                    id             INTEGER  PRIMARY KEY,
+                    version        TEXT     NOT NULL,
+                    description    TEXT     NOT NULL,
+                    checksum       TEXT     NOT NULL,
+                    applied_at     DATETIME NOT NULL,
+                    execution_time FLOAT    NOT NULL,
+                    success        BOOLEAN  NOT NULL,
+                    error_message  TEXT     NOT NULL,
+                    baseline       BOOLEAN  NOT NULL
+                );
+            INSERT INTO %[1]s
+                SELECT
+                    id,
+                    CASE WHEN version = CAST(version AS INTEGER)
+                        THEN CAST(CAST(version AS INTEGER) AS TEXT)
+                        ELSE CAST(version AS TEXT)
+                    END,
+                    description,
+                    checksum,
+                    applied_at,
+                    execution_time,
+                    1,
+                    '',
+                    0
+                FROM %[3]s;
+            DROP TABLE %[3]s;`,
+			s.table(),
+			quoteIdentifier(tableName(s.TableName)+"_v1", `"`),
+			qualifiedName(s.Schema, tableName(s.TableName)+"_v1", `"`))
+	case 2:
+		return fmt.Sprintf(`ALTER TABLE %[1]s RENAME TO %[2]s;
+            CREATE TABLE %[1]s
+                (
+                    id             INTEGER  PRIMARY KEY,
+                    version        TEXT     NOT NULL,
+                    description    TEXT     NOT NULL,
+                    checksum       TEXT     NOT NULL,
+                    applied_at     DATETIME NOT NULL,
+                    execution_time INTEGER  NOT NULL,
+                    success        BOOLEAN  NOT NULL,
+                    error_message  TEXT     NOT NULL,
+                    baseline       BOOLEAN  NOT NULL
+                );
+            INSERT INTO %[1]s
+                SELECT
+                    id,
+                    version,
+                    description,
+                    checksum,
+                    strftime('%%Y-%%m-%%d %%H:%%M:%%S', applied_at, 'unixepoch') || '+00:00',
+                    CAST(round(execution_time) AS INTEGER),
+                    success,
+                    error_message,
+                    baseline
+                FROM %[3]s;
+            DROP TABLE %[3]s;`,
+			s.table(),
+			quoteIdentifier(tableName(s.TableName)+"_v2", `"`),
+			qualifiedName(s.Schema, tableName(s.TableName)+"_v2", `"`))
+	case 3:
+		return fmt.Sprintf(`ALTER TABLE %[1]s ADD COLUMN installed_by TEXT NOT NULL DEFAULT '';
+            ALTER TABLE %[1]s ADD COLUMN hostname TEXT NOT NULL DEFAULT '';
+            ALTER TABLE %[1]s ADD COLUMN app_version TEXT NOT NULL DEFAULT '';
+            ALTER TABLE %[1]s ADD COLUMN installed_rank INTEGER NOT NULL DEFAULT 0;
+            UPDATE %[1]s SET installed_rank = (SELECT COUNT(*) FROM %[1]s AS o WHERE o.id <= %[2]s.id);`,
+			s.table(), quoteIdentifier(tableName(s.TableName), `"`))
+	default:
+		return ""
+	}
+}
+
+// SplitStatements splits script in statements, the body of triggers is kept
+// in the CREATE TRIGGER statement
+func (s SqliteDialect) SplitStatements(script string) []string {
+	return splitStatements(script, splitOptions{
+		backticks:    true,
+		dashComments: true,
+		triggers:     true,
+	})
+}
+
+// table returns the quoted name of the schema table
+func (s SqliteDialect) table() string {
+	return qualifiedName(s.Schema, tableName(s.TableName), `"`)
+}
+
+// schemaVersionTable returns the quoted name of the schema version table
+func (s SqliteDialect) schemaVersionTable() string {
+	return qualifiedName(s.Schema, tableName(s.TableName)+"_schema_version", `"`)
+}
+
+// lockTable returns the quoted name of the lock table
+func (s SqliteDialect) lockTable() string {
+	return qualifiedName(s.Schema, tableName(s.TableName)+"_lock", `"`)
 }
@@ -0,0 +1,131 @@
+package darwin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrUndoNotSupported is returned by Undo when the driver is not a RepairDriver
+var ErrUndoNotSupported = errors.New("darwin: the driver does not support Undo")
+
+// MissingUndoScriptError is used to report when a migration to be undone has no UndoScript
+type MissingUndoScriptError struct {
+	Version Version
+}
+
+func (m MissingUndoScriptError) Error() string {
+	return fmt.Sprintf("Migration %s has no undo script", m.Version)
+}
+
+// Undo reverts the migrations applied after target, running their UndoScript
+// from the newest to the oldest and removing their entries from the schema
+// table, so Migrate applies them again. Nothing is undone if any of them has
+// no UndoScript, including the entry inserted by Baseline.
+// If the driver is a Locker, the lock is held during the whole process.
+func (d Darwin) Undo(target Version) error {
+	return d.UndoContext(context.Background(), target)
+}
+
+// UndoContext is like Undo, but it stops when ctx is done
+func (d Darwin) UndoContext(ctx context.Context, target Version) error {
+	if !target.Valid() {
+		return IllegalMigrationVersionError{Version: target}
+	}
+
+	repairer, ok := d.driver.(RepairDriver)
+
+	if !ok {
+		return ErrUndoNotSupported
+	}
+
+	return d.locked(ctx, func(ctx context.Context) error {
+		err := createContext(ctx, d.driver)
+
+		if err != nil {
+			return err
+		}
+
+		err = d.ValidateContext(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		applied, err := allContext(ctx, d.driver)
+
+		if err != nil {
+			return err
+		}
+
+		migrations := map[Version]Migration{}
+
+		for _, migration := range d.migrations {
+			migrations[migration.Version.canonical()] = migration
+		}
+
+		applied = versionedRecords(applied)
+
+		sort.Sort(sort.Reverse(byMigrationRecordVersion(applied)))
+
+		undo := []MigrationRecord{}
+
+		for _, record := range applied {
+			if record.Version.Compare(target) <= 0 {
+				break
+			}
+
+			migration, ok := migrations[record.Version.canonical()]
+
+			if record.Baseline || !ok || migration.UndoScript == "" {
+				return MissingUndoScriptError{Version: record.Version}
+			}
+
+			undo = append(undo, record)
+		}
+
+		for _, record := range undo {
+			err = d.undo(ctx, repairer, migrations[record.Version.canonical()], record.Version)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// undo executes the UndoScript of migration and removes the entry of version,
+// both in the same transaction when the driver is an UndoDriver. The UndoScript
+// of a migration with NoTransaction runs outside a transaction too.
+func (d Darwin) undo(ctx context.Context, repairer RepairDriver, migration Migration, version Version) error {
+	if migration.NoTransaction {
+		noTxDriver, ok := d.driver.(NoTxDriver)
+
+		if !ok {
+			return ErrNoTxNotSupported
+		}
+
+		_, err := noTxDriver.ExecNoTx(ctx, migration.UndoScript)
+
+		if err != nil {
+			return err
+		}
+
+		return repairer.Delete(ctx, version)
+	}
+
+	if undoDriver, ok := d.driver.(UndoDriver); ok {
+		return undoDriver.ExecDelete(ctx, migration.UndoScript, version)
+	}
+
+	_, err := execContext(ctx, d.driver, migration.UndoScript)
+
+	if err != nil {
+		return err
+	}
+
+	return repairer.Delete(ctx, version)
+}
@@ -0,0 +1,265 @@
+package darwin
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// SchemaVersion is the version of the schema table created by CreateTableSQL.
+// The GenericDriver upgrades schema tables created by older releases of
+// Darwin to it, see UpgradeDialect.
+const SchemaVersion = 4
+
+// legacySchemaVersion is the version of the schema tables created before
+// the versions were stored, without the success column
+const legacySchemaVersion = 1
+
+// UpgradeDialect is implemented by dialects able to upgrade the schema table.
+// The versions of the schema table are stored in another table, the schema
+// version table, with one row for each version.
+type UpgradeDialect interface {
+	// CreateSchemaVersionTableSQL returns the SQL to create the schema version table
+	CreateSchemaVersionTableSQL() string
+
+	// SchemaVersionSQL returns a query for the version of the schema table,
+	// a single row with NULL when no version was stored
+	SchemaVersionSQL() string
+
+	// InsertSchemaVersionSQL returns the SQL to store a new version of the
+	// schema table, the argument is the version
+	InsertSchemaVersionSQL() string
+
+	// ColumnsSQL returns a query for the names of the columns of the schema
+	// table, no rows when it does not exist. It is used to detect the version
+	// of schema tables created before the versions were stored.
+	ColumnsSQL() string
+
+	// UpgradeSQL returns the script upgrading the schema table from version to
+	// version + 1, empty if it cannot be upgraded
+	UpgradeSQL(version int) string
+}
+
+// SchemaVersionError is used to report a schema table that cannot be upgraded
+type SchemaVersionError struct {
+	Version int
+}
+
+func (s SchemaVersionError) Error() string {
+	if s.Version > SchemaVersion {
+		return fmt.Sprintf("Schema table version %d is newer than %d, it was created by a newer Darwin", s.Version, SchemaVersion)
+	}
+
+	return fmt.Sprintf("Cannot upgrade the schema table from version %d to %d", s.Version, SchemaVersion)
+}
+
+// OutdatedSchemaError is used to report a schema table that must be upgraded
+// before it is read, see Plan. Migrate and Create upgrade it.
+type OutdatedSchemaError struct {
+	Version int
+}
+
+func (o OutdatedSchemaError) Error() string {
+	return fmt.Sprintf("Schema table version %d must be upgraded to %d, run Migrate first", o.Version, SchemaVersion)
+}
+
+// createVersioned creates or upgrades the schema table to SchemaVersion. The
+// lock is held while changing it, unless ctx already holds it, see lockHeld.
+func (m *GenericDriver) createVersioned(ctx context.Context, dialect UpgradeDialect) error {
+	err := transactionContext(ctx, m.session(ctx), func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, dialect.CreateSchemaVersionTableSQL())
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	version, err := m.schemaVersion(ctx, dialect)
+
+	if err != nil || version == SchemaVersion {
+		return err
+	}
+
+	if !lockHeld(ctx) {
+		if err := m.Lock(ctx, 0); err != nil {
+			return err
+		}
+
+		defer m.Unlock()
+
+		// Other process may have changed it while waiting for the lock
+		if version, err = m.schemaVersion(ctx, dialect); err != nil {
+			return err
+		}
+	}
+
+	if version > SchemaVersion {
+		return SchemaVersionError{Version: version}
+	}
+
+	if version == 0 {
+		return m.setSchemaVersion(ctx, dialect, m.Dialect.CreateTableSQL(), SchemaVersion)
+	}
+
+	for ; version < SchemaVersion; version++ {
+		script := dialect.UpgradeSQL(version)
+
+		if script == "" {
+			return SchemaVersionError{Version: version}
+		}
+
+		if err := m.setSchemaVersion(ctx, dialect, script, version+1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setSchemaVersion executes the script and stores the version in the same transaction
+func (m *GenericDriver) setSchemaVersion(ctx context.Context, dialect UpgradeDialect, script string, version int) error {
+	return transactionContext(ctx, m.session(ctx), func(tx *sql.Tx) error {
+		if err := m.execScript(ctx, tx, script); err != nil {
+			return err
+		}
+
+		// The installed_rank column is added by the upgrade to version 4
+		if dialect, ok := dialect.(rankDialect); ok && version == 4 {
+			if err := setRanks(ctx, tx, dialect); err != nil {
+				return err
+			}
+		}
+
+		_, err := tx.ExecContext(ctx, dialect.InsertSchemaVersionSQL(), version)
+		return err
+	})
+}
+
+// rankDialect is implemented by the dialects which cannot number the rows in
+// the upgrade script, the ranks are set by setRanks instead
+type rankDialect interface {
+	// rankRowsSQL returns a query for the ids of the rows of the schema
+	// table, in the order they were applied
+	rankRowsSQL() string
+
+	// setRankSQL returns the statement setting the rank of a row by its id
+	setRankSQL() string
+}
+
+// setRanks numbers the rows of the schema table from 1
+func setRanks(ctx context.Context, tx *sql.Tx, dialect rankDialect) error {
+	rows, err := tx.QueryContext(ctx, dialect.rankRowsSQL())
+
+	if err != nil {
+		return err
+	}
+
+	var ids []int64
+
+	for rows.Next() {
+		var id int64
+
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+
+		ids = append(ids, id)
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i, id := range ids {
+		if _, err := tx.ExecContext(ctx, dialect.setRankSQL(), int64(i+1), id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// schemaVersion returns the version of the schema table, 0 if it does not exist
+func (m *GenericDriver) schemaVersion(ctx context.Context, dialect UpgradeDialect) (int, error) {
+	var version sql.NullInt64
+
+	err := m.session(ctx).QueryRowContext(ctx, dialect.SchemaVersionSQL()).Scan(&version)
+
+	if err != nil || version.Valid {
+		return int(version.Int64), err
+	}
+
+	return m.columnsSchemaVersion(ctx, dialect)
+}
+
+// inspectSchemaVersion is like schemaVersion, but it does not change the
+// database, the schema version table may not exist. It returns false when
+// the Dialect is not an UpgradeDialect.
+func (m *GenericDriver) inspectSchemaVersion(ctx context.Context) (int, bool, error) {
+	dialect, ok := m.Dialect.(UpgradeDialect)
+
+	if !ok {
+		return 0, false, nil
+	}
+
+	version, err := m.columnsSchemaVersion(ctx, dialect)
+
+	// The schema version table exists since the success column was added
+	if err != nil || version != 2 {
+		return version, true, err
+	}
+
+	var stored sql.NullInt64
+
+	if err := m.session(ctx).QueryRowContext(ctx, dialect.SchemaVersionSQL()).Scan(&stored); err != nil || !stored.Valid {
+		return version, true, err
+	}
+
+	return int(stored.Int64), true, nil
+}
+
+// columnsSchemaVersion detects the version of the schema table by its
+// columns, for the tables without a stored version
+func (m *GenericDriver) columnsSchemaVersion(ctx context.Context, dialect UpgradeDialect) (int, error) {
+	rows, err := m.session(ctx).QueryContext(ctx, dialect.ColumnsSQL())
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer rows.Close()
+
+	columns := map[string]bool{}
+
+	for rows.Next() {
+		var column string
+
+		if err := rows.Scan(&column); err != nil {
+			return 0, err
+		}
+
+		columns[column] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	switch {
+	case len(columns) == 0:
+		return 0, nil
+	case columns["installed_rank"]:
+		// Created by CreateTableSQL without storing the version, like by
+		// the scripts of MigrationPlan.Script
+		return 4, nil
+	case !columns["success"]:
+		return legacySchemaVersion, nil
+	default:
+		// Created by the first release storing the versions
+		return 2, nil
+	}
+}
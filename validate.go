@@ -0,0 +1,170 @@
+package darwin
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ValidationReport lists every problem found by ValidateAll
+type ValidationReport struct {
+	IllegalVersions       []IllegalMigrationVersionError
+	MissingFuncChecksums  []MissingFuncChecksumError
+	DuplicatedVersions    []DuplicateMigrationVersionError
+	DuplicatedRepeatables []DuplicateRepeatableMigrationError
+	Failed                []FailedMigrationError
+	Removed               []RemovedMigrationError
+	InvalidChecksums      []InvalidChecksumError
+
+	// Ignored are the migrations older than the last applied one, they are
+	// errors only with Strict. They are not reported with OutOfOrder.
+	Ignored []IgnoredMigrationError
+
+	strict bool
+}
+
+// Errors returns every problem of the report, in the order Validate checks them
+func (r ValidationReport) Errors() []error {
+	errs := []error{}
+
+	for _, err := range r.IllegalVersions {
+		errs = append(errs, err)
+	}
+
+	for _, err := range r.MissingFuncChecksums {
+		errs = append(errs, err)
+	}
+
+	for _, err := range r.DuplicatedVersions {
+		errs = append(errs, err)
+	}
+
+	for _, err := range r.DuplicatedRepeatables {
+		errs = append(errs, err)
+	}
+
+	for _, err := range r.Failed {
+		errs = append(errs, err)
+	}
+
+	for _, err := range r.Removed {
+		errs = append(errs, err)
+	}
+
+	for _, err := range r.InvalidChecksums {
+		errs = append(errs, err)
+	}
+
+	if r.strict {
+		for _, err := range r.Ignored {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// Err returns nil when the report has no errors, the error itself when it
+// has only one and a ValidationError otherwise
+func (r ValidationReport) Err() error {
+	errs := r.Errors()
+
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return ValidationError{Errors: errs}
+	}
+}
+
+// ValidationError is used to report many validation problems at once
+type ValidationError struct {
+	Errors []error
+}
+
+func (v ValidationError) Error() string {
+	messages := make([]string, len(v.Errors))
+
+	for i, err := range v.Errors {
+		messages[i] = err.Error()
+	}
+
+	return fmt.Sprintf("%d validation errors: %s", len(v.Errors), strings.Join(messages, "; "))
+}
+
+// Unwrap returns the errors, so errors.Is and errors.As look for each one
+func (v ValidationError) Unwrap() []error {
+	return v.Errors
+}
+
+// ValidateAll checks the migrations like Validate, but it reports every
+// problem instead of the first one. The error is only used for failures
+// reading the schema table.
+func (d Darwin) ValidateAll() (ValidationReport, error) {
+	return d.ValidateAllContext(context.Background())
+}
+
+// ValidateAllContext is like ValidateAll, but it stops when ctx is done
+func (d Darwin) ValidateAllContext(ctx context.Context) (ValidationReport, error) {
+	applied, err := d.appliedRecords(ctx)
+
+	if err != nil {
+		// Only the migrations are checked
+		return d.validationReport([]MigrationRecord{}), err
+	}
+
+	return d.validationReport(applied), nil
+}
+
+// validationReport checks the migrations against the applied records
+func (d Darwin) validationReport(applied []MigrationRecord) ValidationReport {
+	report := ValidationReport{strict: d.Strict && !d.OutOfOrder}
+	migrations := d.migrations
+
+	sort.Sort(byMigrationVersion(migrations))
+
+	for _, version := range invalidVersions(migrations) {
+		report.IllegalVersions = append(report.IllegalVersions, IllegalMigrationVersionError{Version: version})
+	}
+
+	if d.Target != "" && !d.Target.Valid() {
+		report.IllegalVersions = append(report.IllegalVersions, IllegalMigrationVersionError{Version: d.Target})
+	}
+
+	for _, version := range missingFuncChecksums(migrations) {
+		report.MissingFuncChecksums = append(report.MissingFuncChecksums, MissingFuncChecksumError{Version: version})
+	}
+
+	for _, version := range duplicatedVersions(migrations) {
+		report.DuplicatedVersions = append(report.DuplicatedVersions, DuplicateMigrationVersionError{Version: version})
+	}
+
+	for _, description := range duplicatedRepeatables(migrations) {
+		report.DuplicatedRepeatables = append(report.DuplicatedRepeatables, DuplicateRepeatableMigrationError{Description: description})
+	}
+
+	for _, record := range failedMigrations(applied) {
+		report.Failed = append(report.Failed, FailedMigrationError{Version: record.Version, Message: record.ErrorMessage})
+	}
+
+	// Repeatable migrations are checked by their checksum only when migrating
+	migrations, _ = splitRepeatable(migrations)
+	applied = versionedRecords(applied)
+
+	for _, version := range removedMigrations(applied, migrations) {
+		report.Removed = append(report.Removed, RemovedMigrationError{Version: version})
+	}
+
+	report.InvalidChecksums = append(report.InvalidChecksums, d.invalidChecksumMigrations(applied, migrations)...)
+
+	if !d.OutOfOrder {
+		for _, version := range ignoredMigrations(applied, migrations) {
+			report.Ignored = append(report.Ignored, IgnoredMigrationError{Version: version})
+		}
+	}
+
+	return report
+}
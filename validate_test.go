@@ -0,0 +1,120 @@
+package darwin
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func Test_ValidateAll(t *testing.T) {
+	records := []MigrationRecord{
+		{Version: "1", Checksum: "3310d0ff858faac79e854454c9e403da"},
+		{Version: "2", Checksum: "invalid"},
+		{Version: "4", Checksum: "3310d0ff858faac79e854454c9e403da"},
+		{Version: "5", Checksum: "3310d0ff858faac79e854454c9e403da"},
+		{Version: "7", Checksum: "3310d0ff858faac79e854454c9e403da"},
+	}
+
+	migrations := []Migration{
+		{Version: "1", Description: "First Migration", Script: "does not matter!"},
+		{Version: "1.0", Description: "First Migration again", Script: "does not matter!"},
+		{Version: "1.a", Description: "Illegal Migration", Script: "does not matter!"},
+		{Version: "2", Description: "Second Migration", Script: "does not matter!"},
+		{Version: "3", Description: "Ignored Migration", Script: "does not matter!"},
+		{Version: "7", Description: "Seventh Migration", Script: "does not matter!"},
+	}
+
+	report, err := New(&dummyDriver{records: records}, migrations, nil).ValidateAll()
+
+	if err != nil {
+		t.Fatalf("ValidateAll() error = %s, wants nil", err)
+	}
+
+	expected := ValidationReport{
+		IllegalVersions:    []IllegalMigrationVersionError{{Version: "1.a"}},
+		DuplicatedVersions: []DuplicateMigrationVersionError{{Version: "1.0"}},
+		Removed:            []RemovedMigrationError{{Version: "4"}, {Version: "5"}},
+		InvalidChecksums: []InvalidChecksumError{
+			{Version: "2", Stored: "invalid", Computed: "3310d0ff858faac79e854454c9e403da"},
+		},
+		Ignored: []IgnoredMigrationError{{Version: "3"}},
+	}
+
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("ValidateAll() = %+v, wants %+v", report, expected)
+	}
+
+	if len(report.Errors()) != 5 {
+		t.Errorf("Ignored migrations must be errors only with Strict, got %v", report.Errors())
+	}
+}
+
+func Test_ValidateAll_error(t *testing.T) {
+	_, err := New(&dummyDriver{AllError: true}, []Migration{}, nil).ValidateAll()
+
+	if err == nil {
+		t.Error("Must return the driver error")
+	}
+}
+
+func Test_Validate_many_errors(t *testing.T) {
+	records := []MigrationRecord{
+		{Version: "1", Checksum: "invalid"},
+		{Version: "2", Checksum: "3310d0ff858faac79e854454c9e403da"},
+	}
+
+	migrations := []Migration{
+		{Version: "1", Description: "First Migration", Script: "does not matter!"},
+		{Version: "3", Description: "Third Migration", Script: "does not matter!"},
+		{Version: "3", Description: "Third Migration", Script: "does not matter!"},
+	}
+
+	err := New(&dummyDriver{records: records}, migrations, nil).Validate()
+
+	var validationError ValidationError
+
+	if !errors.As(err, &validationError) || len(validationError.Errors) != 3 {
+		t.Fatalf("Validate() error = %v, wants a ValidationError with 3 errors", err)
+	}
+
+	var duplicated DuplicateMigrationVersionError
+	var removed RemovedMigrationError
+	var invalid InvalidChecksumError
+
+	if !errors.As(err, &duplicated) || !errors.As(err, &removed) || !errors.As(err, &invalid) {
+		t.Errorf("Validate() error = %v, wants every error to be found by errors.As", err)
+	}
+
+	if removed.Version != "2" || invalid.Version != "1" || duplicated.Version != "3" {
+		t.Errorf("Unexpected errors %v", validationError.Errors)
+	}
+}
+
+func Test_ValidationReport_Err(t *testing.T) {
+	if err := (ValidationReport{}).Err(); err != nil {
+		t.Errorf("Err() = %v, wants nil", err)
+	}
+
+	report := ValidationReport{Removed: []RemovedMigrationError{{Version: "1"}}}
+
+	if err := report.Err(); err != (RemovedMigrationError{Version: "1"}) {
+		t.Errorf("Err() = %v, wants the only error", err)
+	}
+
+	report = ValidationReport{Ignored: []IgnoredMigrationError{{Version: "1"}}, strict: true}
+
+	if err := report.Err(); err != (IgnoredMigrationError{Version: "1"}) {
+		t.Errorf("Err() = %v, wants the ignored migration with Strict", err)
+	}
+}
+
+func Test_ValidationError_Error(t *testing.T) {
+	err := ValidationError{Errors: []error{
+		RemovedMigrationError{Version: "1"},
+		InvalidChecksumError{Version: "2"},
+	}}
+
+	if err.Error() != "2 validation errors: Migration 1 was removed; Invalid cheksum for migration 2" {
+		t.Errorf("Unexpected error message %q", err.Error())
+	}
+}
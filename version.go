@@ -0,0 +1,108 @@
+package darwin
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a migration version made of numbers separated by dots, like 1,
+// 1.2 or 1.2.10. The numbers are compared one by one, so 1.10 is greater than
+// 1.2, and missing numbers are zeros, so 1 and 1.0 are the same version.
+type Version string
+
+// Valid reports whether v is a well formed version
+func (v Version) Valid() bool {
+	_, err := v.parts()
+	return err == nil
+}
+
+// Compare returns -1, 0 or +1 when v is lower, equal or greater than o.
+// Malformed versions are lower than the valid ones.
+func (v Version) Compare(o Version) int {
+	a, aerr := v.parts()
+	b, berr := o.parts()
+
+	switch {
+	case aerr != nil && berr != nil:
+		return strings.Compare(string(v), string(o))
+	case aerr != nil:
+		return -1
+	case berr != nil:
+		return 1
+	}
+
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y uint64
+
+		if i < len(a) {
+			x = a[i]
+		}
+
+		if i < len(b) {
+			y = b[i]
+		}
+
+		if x < y {
+			return -1
+		}
+
+		if x > y {
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// Equal reports whether v and o are the same version, like 1 and 1.0
+func (v Version) Equal(o Version) bool {
+	return v.Compare(o) == 0
+}
+
+func (v Version) String() string {
+	return string(v)
+}
+
+// canonical returns v without leading zeros and trailing zero parts, so equal
+// versions have the same canonical form
+func (v Version) canonical() Version {
+	parts, err := v.parts()
+
+	if err != nil {
+		return v
+	}
+
+	for len(parts) > 1 && parts[len(parts)-1] == 0 {
+		parts = parts[:len(parts)-1]
+	}
+
+	fields := make([]string, len(parts))
+
+	for i, part := range parts {
+		fields[i] = strconv.FormatUint(part, 10)
+	}
+
+	return Version(strings.Join(fields, "."))
+}
+
+func (v Version) parts() ([]uint64, error) {
+	if v == "" {
+		return nil, fmt.Errorf("empty version")
+	}
+
+	fields := strings.Split(string(v), ".")
+	parts := make([]uint64, len(fields))
+
+	for i, field := range fields {
+		part, err := strconv.ParseUint(field, 10, 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("malformed version %q", string(v))
+		}
+
+		parts[i] = part
+	}
+
+	return parts, nil
+}
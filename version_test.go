@@ -0,0 +1,107 @@
+package darwin
+
+import (
+	"sort"
+	"testing"
+)
+
+func Test_Version_Compare(t *testing.T) {
+	expectations := []struct {
+		a, b     Version
+		expected int
+	}{
+		{"1", "1", 0},
+		{"1", "1.0", 0},
+		{"1.0.0", "1", 0},
+		{"01.2", "1.2", 0},
+		{"1.2", "1.10", -1},
+		{"1.10", "1.2", 1},
+		{"1.2.10", "1.2.9", 1},
+		{"1.1", "1.10", -1},
+		{"2", "1.99", 1},
+		{"invalid", "1", -1},
+		{"1", "invalid", 1},
+		{"a", "b", -1},
+	}
+
+	for _, expectation := range expectations {
+		if actual := expectation.a.Compare(expectation.b); actual != expectation.expected {
+			t.Errorf("%s.Compare(%s) = %d, wants %d", expectation.a, expectation.b, actual, expectation.expected)
+		}
+	}
+}
+
+func Test_Version_Valid(t *testing.T) {
+	valid := []Version{"1", "1.2", "1.2.10", "0", "2016.10.01"}
+	invalid := []Version{"", "-1", "1.", ".1", "1..2", "1.a", "v1", "1.2-beta", "+1"}
+
+	for _, version := range valid {
+		if !version.Valid() {
+			t.Errorf("%q must be valid", version)
+		}
+	}
+
+	for _, version := range invalid {
+		if version.Valid() {
+			t.Errorf("%q must be invalid", version)
+		}
+	}
+}
+
+func Test_Version_canonical(t *testing.T) {
+	expectations := map[Version]Version{
+		"1":       "1",
+		"1.0":     "1",
+		"1.0.0":   "1",
+		"0":       "0",
+		"0.0":     "0",
+		"01.020":  "1.20",
+		"1.10.0":  "1.10",
+		"invalid": "invalid",
+	}
+
+	for version, expected := range expectations {
+		if actual := version.canonical(); actual != expected {
+			t.Errorf("%q.canonical() = %q, wants %q", version, actual, expected)
+		}
+	}
+}
+
+func Test_byMigrationVersion_multiple_parts(t *testing.T) {
+	unordered := []Migration{
+		{Version: "1.10"},
+		{Version: "1.2.10"},
+		{Version: "1.2"},
+		{Version: "1.2.9"},
+	}
+
+	sort.Sort(byMigrationVersion(unordered))
+
+	expected := []Version{"1.2", "1.2.9", "1.2.10", "1.10"}
+
+	for i, migration := range unordered {
+		if migration.Version != expected[i] {
+			t.Errorf("unordered[%d].Version = %s, wants %s", i, migration.Version, expected[i])
+		}
+	}
+}
+
+func Test_Validate_equivalent_versions(t *testing.T) {
+	migrations := []Migration{
+		{Version: "1.1", Script: "does not matter!"},
+		{Version: "1.10", Script: "does not matter!"},
+	}
+
+	if err := Validate(&dummyDriver{}, migrations); err != nil {
+		t.Errorf("1.1 and 1.10 must be different versions, got %s", err)
+	}
+
+	migrations = []Migration{
+		{Version: "1", Script: "does not matter!"},
+		{Version: "1.0", Script: "does not matter!"},
+	}
+
+	if _, ok := Validate(&dummyDriver{}, migrations).(DuplicateMigrationVersionError); !ok {
+		t.Error("1 and 1.0 must be the same version")
+	}
+}